@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/sardap/vibes/bot/geo"
+)
+
+//maxChoices is the most choices discord accepts for autocomplete
+const maxChoices = 25
+
+func autocompleteRespond(
+	s *discordgo.Session, i *discordgo.InteractionCreate,
+	choices []*discordgo.ApplicationCommandOptionChoice,
+) {
+	err := respond(s, i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{
+			Choices: choices,
+		},
+	})
+	if err != nil {
+		log.Printf("%s Unable to respond to autocomplete: %v\n", i.ID, err)
+	}
+}
+
+func setupAutocomplete(s *discordgo.Session, i *discordgo.InteractionCreate, opts setupOptions) {
+	country := opts.Country
+	if _, ok := geo.LookupCountry(country); !ok {
+		country = ""
+	}
+
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0)
+	for _, opt := range i.ApplicationCommandData().Options {
+		if !opt.Focused {
+			continue
+		}
+
+		query := opt.StringValue()
+		switch opt.Name {
+		case "country":
+			for _, c := range geo.SearchCountries(query, maxChoices) {
+				choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+					Name:  fmt.Sprintf("%s (%s)", c.Name, c.Code),
+					Value: c.Code,
+				})
+			}
+		case "city":
+			for _, c := range geo.SearchCities(country, query, maxChoices) {
+				choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+					Name:  fmt.Sprintf("%s, %s", c.Name, c.Country),
+					Value: c.Name,
+				})
+			}
+		case "timezone":
+			//Suggest the city's own zone first
+			for _, c := range geo.LookupCity(opts.City) {
+				if country == "" || c.Country == country {
+					choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+						Name: c.Zone, Value: c.Zone,
+					})
+					break
+				}
+			}
+			for _, z := range geo.SearchZones(country, query, maxChoices) {
+				if len(choices) >= maxChoices {
+					break
+				}
+				if len(choices) > 0 && choices[0].Value == z.Zone {
+					continue
+				}
+				choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+					Name: z.Zone, Value: z.Zone,
+				})
+			}
+		}
+	}
+
+	autocompleteRespond(s, i, choices)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/sardap/vibes/bot/vibes"
+)
+
+//configPollInterval is how often the config file is checked for changes
+const configPollInterval = 10 * time.Second
+
+//currentBackends is swapped out whenever the config is reloaded, sessions
+//keep the invoker they started with
+var currentBackends atomic.Pointer[backendSet]
+
+//backendSet is the configured backends
+type backendSet struct {
+	sets map[string]*vibeInfo
+	//keys are in config order
+	keys []string
+}
+
+//backendLoader builds backend sets from the config
+type backendLoader struct {
+	path    string
+	client  *http.Client
+	timeout time.Duration
+	cache   *vibes.Cache
+}
+
+//load reads the config and replaces currentBackends, the old set is kept if
+//the config is invalid
+func (l *backendLoader) load() error {
+	result, err := l.build()
+	if err != nil {
+		return err
+	}
+
+	currentBackends.Store(result)
+	return nil
+}
+
+//build reads the config into a backend set without using it
+func (l *backendLoader) build() (*backendSet, error) {
+	cfg, err := loadConfig(l.path)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &backendSet{
+		sets: make(map[string]*vibeInfo),
+		keys: make([]string, 0, len(cfg.Backends)),
+	}
+	for _, b := range cfg.Backends {
+		result.keys = append(result.keys, b.Name)
+		result.sets[b.Name] = &vibeInfo{
+			command:     b.Name,
+			displayName: b.DisplayName,
+			description: b.Description,
+			invoker: vibes.Invoker{
+				Endpoint:  b.Endpoint,
+				AccessKey: b.AccessKey,
+				Scheme:    b.Scheme,
+				Username:  b.Username,
+				Password:  b.Password,
+				Client:    l.client,
+				Timeout:   l.timeout,
+				Cache:     l.cache,
+			},
+		}
+	}
+
+	return result, nil
+}
+
+//modified returns when the config file was last changed
+func (l *backendLoader) modified() (time.Time, error) {
+	info, err := os.Stat(l.path)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return info.ModTime(), nil
+}
+
+//reloadBackends loads the config again and updates the commands which list
+//the backends, the new backends are only used once discord has the commands
+//for them
+func reloadBackends(s *discordgo.Session, cs commandSet) error {
+	backends, err := cs.loader.build()
+	if err != nil {
+		return err
+	}
+
+	commands := make(map[string]*discordgo.ApplicationCommand, len(cs.commands))
+	for name, cmd := range cs.commands {
+		commands[name] = cmd
+	}
+	for name, cmd := range backendCommands(backends) {
+		commands[name] = cmd
+	}
+
+	if err := syncCommands(s, commands); err != nil {
+		//Some commands might have been sent, putting the old ones back
+		//keeps them matching the backends still in use
+		old := make(map[string]*discordgo.ApplicationCommand, len(commands))
+		for name, cmd := range commands {
+			old[name] = cmd
+		}
+		for name, cmd := range backendCommands(currentBackends.Load()) {
+			old[name] = cmd
+		}
+		if err := syncCommands(s, old); err != nil {
+			log.Printf("Unable to put the old commands back: %v\n", err)
+		}
+		return fmt.Errorf("updating commands: %w", err)
+	}
+
+	currentBackends.Store(backends)
+	log.Printf("Reloaded config now has %d backends\n", len(backends.keys))
+	return nil
+}
+
+//watchConfig reloads the backends on SIGHUP or when the config file changes
+func watchConfig(s *discordgo.Session, cs commandSet) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	var poll <-chan time.Time
+	var lastModified time.Time
+	if cs.loader.path != "" {
+		ticker := time.NewTicker(configPollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+		lastModified, _ = cs.loader.modified()
+	}
+
+	for {
+		select {
+		case <-hup:
+			log.Println("Got SIGHUP reloading config")
+		case <-poll:
+			modified, err := cs.loader.modified()
+			if err != nil || modified.Equal(lastModified) {
+				continue
+			}
+			lastModified = modified
+			log.Println("Config changed reloading")
+		}
+
+		if err := reloadBackends(s, cs); err != nil {
+			log.Printf("Unable to reload config keeping the old one: %v\n", err)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+//Package clock lets the scheduling code be driven by a fake clock so hour
+//changes, bells and start offsets can be tested without waiting for them
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+//Clock tells the time and waits for it to pass
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+//Real is the system clock
+type Real struct{}
+
+//Now returns time.Now
+func (Real) Now() time.Time {
+	return time.Now()
+}
+
+//After returns time.After
+func (Real) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+type waiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+//Fake is a Clock which only moves when told to, After fires once the
+//clock has been advanced past it
+type Fake struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []waiter
+	changed chan struct{}
+}
+
+//NewFake returns a fake clock stopped at now
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now, changed: make(chan struct{})}
+}
+
+//Now returns the fake time
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.now
+}
+
+//After returns a channel which receives the fake time once it's d past now
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- f.now
+		return ch
+	}
+
+	f.waiters = append(f.waiters, waiter{f.now.Add(d), ch})
+	f.notify()
+	return ch
+}
+
+//Advance moves the clock forward firing anything waiting along the way in
+//order
+func (f *Fake) Advance(d time.Duration) {
+	f.Set(f.Now().Add(d))
+}
+
+//Set moves the clock to t, it can't go backwards
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if t.Before(f.now) {
+		return
+	}
+
+	sort.SliceStable(f.waiters, func(i, j int) bool {
+		return f.waiters[i].at.Before(f.waiters[j].at)
+	})
+
+	remaining := f.waiters[:0]
+	for _, w := range f.waiters {
+		if w.at.After(t) {
+			remaining = append(remaining, w)
+			continue
+		}
+		w.ch <- w.at
+	}
+	f.waiters = remaining
+	f.now = t
+	f.notify()
+}
+
+//Waiters returns how many After calls haven't fired yet
+func (f *Fake) Waiters() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return len(f.waiters)
+}
+
+//BlockUntil waits until at least n After calls are waiting, letting tests
+//know the code under test has caught up before advancing
+func (f *Fake) BlockUntil(n int) {
+	for {
+		f.mu.Lock()
+		if len(f.waiters) >= n {
+			f.mu.Unlock()
+			return
+		}
+		changed := f.changed
+		f.mu.Unlock()
+
+		<-changed
+	}
+}
+
+//notify wakes anything in BlockUntil, must hold mu
+func (f *Fake) notify() {
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
@@ -0,0 +1,68 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFake(t *testing.T) {
+	start := time.Date(2021, 1, 2, 13, 0, 0, 0, time.UTC)
+	f := NewFake(start)
+
+	now := f.After(0)
+	if got := <-now; !got.Equal(start) {
+		t.Errorf("After(0) fired at %s want now", got)
+	}
+
+	later := f.After(2 * time.Minute)
+	sooner := f.After(time.Minute)
+	if f.Waiters() != 2 {
+		t.Fatalf("%d waiters want 2", f.Waiters())
+	}
+
+	f.Advance(30 * time.Second)
+	select {
+	case <-sooner:
+		t.Fatal("fired before its time")
+	default:
+	}
+
+	f.Advance(time.Minute)
+	if got := <-sooner; !got.Equal(start.Add(time.Minute)) {
+		t.Errorf("fired at %s want when it was due", got)
+	}
+	if f.Waiters() != 1 {
+		t.Errorf("%d waiters want 1", f.Waiters())
+	}
+
+	//Going backwards is ignored
+	f.Set(start)
+	if !f.Now().Equal(start.Add(90 * time.Second)) {
+		t.Errorf("clock went back to %s", f.Now())
+	}
+
+	f.Advance(time.Hour)
+	if got := <-later; !got.Equal(start.Add(2 * time.Minute)) {
+		t.Errorf("fired at %s want when it was due", got)
+	}
+}
+
+func TestFakeBlockUntil(t *testing.T) {
+	f := NewFake(time.Date(2021, 1, 2, 13, 0, 0, 0, time.UTC))
+
+	done := make(chan struct{})
+	go func() {
+		f.BlockUntil(2)
+		close(done)
+	}()
+
+	f.After(time.Second)
+	select {
+	case <-done:
+		t.Fatal("BlockUntil returned with one waiter")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	f.After(time.Second)
+	<-done
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+)
+
+//maxChoiceLength is the longest name or value discord accepts for a choice
+const maxChoiceLength = 100
+
+var backendNamePattern = regexp.MustCompile("^[A-Za-z0-9_-]+$")
+
+//backendConfig is a backend the bot can play sets from
+type backendConfig struct {
+	//Name is the value used by /start, letters, numbers, - and _
+	Name      string `json:"name"`
+	Scheme    string `json:"scheme"`
+	Endpoint  string `json:"endpoint"`
+	AccessKey string `json:"access_key"`
+	Username  string `json:"username,omitempty"`
+	Password  string `json:"password,omitempty"`
+	//DisplayName is shown in /start's choices, defaults to Name
+	DisplayName string `json:"display_name,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+//botConfig is the file pointed to by VIBES_CONFIG
+type botConfig struct {
+	Backends []backendConfig `json:"backends"`
+}
+
+//loadConfig reads the config from path applying env overrides. If path is
+//empty the old VIBES_n variables are used instead.
+func loadConfig(path string) (*botConfig, error) {
+	var cfg botConfig
+	if path == "" {
+		cfg.Backends = legacyBackends()
+		if len(cfg.Backends) > 0 {
+			log.Println("VIBES_n is deprecated use a VIBES_CONFIG file instead")
+		}
+	} else {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading config: %w", err)
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&cfg); err != nil {
+			return nil, fmt.Errorf("parsing config %s: %w", path, err)
+		}
+	}
+
+	for i := range cfg.Backends {
+		cfg.Backends[i].applyEnv()
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	return &cfg, nil
+}
+
+//legacyBackends converts VIBES_n (name,scheme,endpoint,access key) into
+//backends, bad entries are kept as is so validate can report them
+func legacyBackends() []backendConfig {
+	result := make([]backendConfig, 0)
+	for i := 0; ; i++ {
+		str := os.Getenv(fmt.Sprintf("VIBES_%d", i))
+		if str == "" {
+			break
+		}
+
+		splits := strings.Split(str, ",")
+		if len(splits) != 4 {
+			//Leave the endpoint empty so validate complains about it
+			log.Printf("VIBES_%d should be name,scheme,endpoint,access_key\n", i)
+			result = append(result, backendConfig{Name: splits[0]})
+			continue
+		}
+
+		result = append(result, backendConfig{
+			Name:      splits[0],
+			Scheme:    splits[1],
+			Endpoint:  splits[2],
+			AccessKey: splits[3],
+		})
+	}
+
+	return result
+}
+
+//envName is the prefix for the backend's overrides e.g. VIBES_CASE_FANS_,
+//- can't be used in variable names so it's replaced with _
+func (b *backendConfig) envName() string {
+	return "VIBES_" + strings.ToUpper(strings.ReplaceAll(b.Name, "-", "_")) + "_"
+}
+
+//applyEnv overrides fields with VIBES_<NAME>_<FIELD> so secrets can be kept
+//out of the file. VIBES_USERNAME and VIBES_PASSWORD fill in missing
+//credentials for every backend.
+func (b *backendConfig) applyEnv() {
+	fields := map[string]*string{
+		"SCHEME":     &b.Scheme,
+		"ENDPOINT":   &b.Endpoint,
+		"ACCESS_KEY": &b.AccessKey,
+		"USERNAME":   &b.Username,
+		"PASSWORD":   &b.Password,
+	}
+	for name, field := range fields {
+		if str, ok := os.LookupEnv(b.envName() + name); ok {
+			*field = str
+		}
+	}
+
+	if b.Username == "" {
+		b.Username = os.Getenv("VIBES_USERNAME")
+	}
+	if b.Password == "" {
+		b.Password = os.Getenv("VIBES_PASSWORD")
+	}
+	if b.DisplayName == "" {
+		b.DisplayName = b.Name
+	}
+}
+
+//validate returns every problem with the config at once
+func (c *botConfig) validate() error {
+	errs := make([]error, 0)
+	if len(c.Backends) == 0 {
+		errs = append(errs, errors.New("no backends configured"))
+	}
+
+	seen := make(map[string]bool)
+	//animal-crossing and animal_crossing would share overrides
+	seenEnv := make(map[string]bool)
+	for i, b := range c.Backends {
+		where := fmt.Sprintf("backends[%d]", i)
+		if b.Name != "" {
+			where = fmt.Sprintf("%s (%s)", where, b.Name)
+		}
+		fail := func(format string, a ...interface{}) {
+			errs = append(errs, fmt.Errorf("%s: %s", where, fmt.Sprintf(format, a...)))
+		}
+
+		switch {
+		case b.Name == "":
+			fail("name is required")
+		case b.Name == "random":
+			fail("name random is used by /start to pick any backend")
+		case !backendNamePattern.MatchString(b.Name):
+			fail("name can only have letters, numbers, - and _")
+		case len(b.Name) > maxChoiceLength:
+			fail("name can't be longer than %d", maxChoiceLength)
+		case seen[b.Name]:
+			fail("name is used by another backend")
+		case seenEnv[b.envName()]:
+			fail("name has the same %s overrides as another backend", b.envName())
+		}
+		seen[b.Name] = true
+		seenEnv[b.envName()] = true
+
+		if b.Scheme != "http" && b.Scheme != "https" {
+			fail("scheme must be http or https not %q", b.Scheme)
+		}
+		if b.Endpoint == "" {
+			fail("endpoint is required")
+		} else if strings.Contains(b.Endpoint, "://") {
+			fail("endpoint should be a host like example.com without the scheme")
+		}
+		if b.AccessKey == "" {
+			fail("access_key is required, set it or %sACCESS_KEY", b.envName())
+		}
+		if (b.Username == "") != (b.Password == "") {
+			fail("username and password must be set together")
+		}
+		if len(b.DisplayName) > maxChoiceLength {
+			fail("display_name can't be longer than %d", maxChoiceLength)
+		}
+	}
+
+	//Discord only allows 25 choices and one is random
+	if len(c.Backends) > maxChoices-1 {
+		errs = append(errs, fmt.Errorf(
+			"at most %d backends can be configured not %d", maxChoices-1, len(c.Backends),
+		))
+	}
+
+	return errors.Join(errs...)
+}
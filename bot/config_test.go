@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+//testBackend returns a backend that passes validate
+func testBackend(name string) backendConfig {
+	return backendConfig{
+		Name:        name,
+		Scheme:      "https",
+		Endpoint:    "vibes.example.com",
+		AccessKey:   "key",
+		DisplayName: name,
+	}
+}
+
+//testBackends returns n valid backends with different names
+func testBackends(n int) []backendConfig {
+	result := make([]backendConfig, n)
+	for i := range result {
+		result[i] = testBackend(fmt.Sprintf("backend_%d", i))
+	}
+
+	return result
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		backends []backendConfig
+		//change is applied to the first backend
+		change func(b *backendConfig)
+		//wantErr is part of the error or empty if it's valid
+		wantErr string
+	}{
+		{name: "valid", backends: []backendConfig{testBackend("cafe")}},
+		{
+			name:     "dash in the name",
+			backends: []backendConfig{testBackend("animal-crossing")},
+		},
+		{name: "no backends", wantErr: "no backends configured"},
+		{
+			name:     "no name",
+			backends: []backendConfig{testBackend("")},
+			wantErr:  "name is required",
+		},
+		{
+			name:     "random",
+			backends: []backendConfig{testBackend("random")},
+			wantErr:  "name random is used by /start",
+		},
+		{
+			name:     "space in the name",
+			backends: []backendConfig{testBackend("case fans")},
+			wantErr:  "name can only have",
+		},
+		{
+			name:     "duplicate",
+			backends: []backendConfig{testBackend("cafe"), testBackend("cafe")},
+			wantErr:  "backends[1] (cafe): name is used by another backend",
+		},
+		{
+			name: "same overrides",
+			backends: []backendConfig{
+				testBackend("animal_crossing"), testBackend("animal-crossing"),
+			},
+			wantErr: "same VIBES_ANIMAL_CROSSING_ overrides",
+		},
+		{
+			name:     "bad scheme",
+			backends: []backendConfig{testBackend("cafe")},
+			change:   func(b *backendConfig) { b.Scheme = "ftp" },
+			wantErr:  `scheme must be http or https not "ftp"`,
+		},
+		{
+			name:     "no endpoint",
+			backends: []backendConfig{testBackend("cafe")},
+			change:   func(b *backendConfig) { b.Endpoint = "" },
+			wantErr:  "endpoint is required",
+		},
+		{
+			name:     "endpoint with a scheme",
+			backends: []backendConfig{testBackend("cafe")},
+			change:   func(b *backendConfig) { b.Endpoint = "https://vibes.example.com" },
+			wantErr:  "without the scheme",
+		},
+		{
+			name:     "no access key",
+			backends: []backendConfig{testBackend("animal-crossing")},
+			change:   func(b *backendConfig) { b.AccessKey = "" },
+			wantErr:  "set it or VIBES_ANIMAL_CROSSING_ACCESS_KEY",
+		},
+		{
+			name:     "only username",
+			backends: []backendConfig{testBackend("cafe")},
+			change:   func(b *backendConfig) { b.Username = "user" },
+			wantErr:  "username and password must be set together",
+		},
+		{
+			name:     "only password",
+			backends: []backendConfig{testBackend("cafe")},
+			change:   func(b *backendConfig) { b.Password = "hunter2" },
+			wantErr:  "username and password must be set together",
+		},
+		{
+			name:     "both credentials",
+			backends: []backendConfig{testBackend("cafe")},
+			change: func(b *backendConfig) {
+				b.Username = "user"
+				b.Password = "hunter2"
+			},
+		},
+		{
+			name:     "long display name",
+			backends: []backendConfig{testBackend("cafe")},
+			change: func(b *backendConfig) {
+				b.DisplayName = strings.Repeat("a", maxChoiceLength+1)
+			},
+			wantErr: "display_name can't be longer",
+		},
+		{name: "most backends", backends: testBackends(maxChoices - 1)},
+		{
+			name:     "too many backends",
+			backends: testBackends(maxChoices),
+			wantErr:  "at most 24 backends can be configured not 25",
+		},
+	}
+
+	for _, test := range tests {
+		cfg := botConfig{Backends: test.backends}
+		if test.change != nil {
+			test.change(&cfg.Backends[0])
+		}
+
+		err := cfg.validate()
+		switch {
+		case test.wantErr == "" && err != nil:
+			t.Errorf("%s: validate() = %v want nil", test.name, err)
+		case test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)):
+			t.Errorf("%s: validate() = %v want %q", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestLegacyBackends(t *testing.T) {
+	t.Setenv("VIBES_0", "cafe,https,cafe.example.com,key")
+	t.Setenv("VIBES_1", "animal-crossing,https,vibes.example.com")
+	t.Setenv("VIBES_2", "")
+	//Nothing after the first gap is read
+	t.Setenv("VIBES_3", "late,https,late.example.com,key")
+
+	backends := legacyBackends()
+	if len(backends) != 2 {
+		t.Fatalf("legacyBackends() = %+v want 2 backends", backends)
+	}
+	want := backendConfig{
+		Name: "cafe", Scheme: "https", Endpoint: "cafe.example.com", AccessKey: "key",
+	}
+	if backends[0] != want {
+		t.Errorf("backends[0] = %+v want %+v", backends[0], want)
+	}
+	//The malformed one is kept for validate to complain about
+	if want := (backendConfig{Name: "animal-crossing"}); backends[1] != want {
+		t.Errorf("backends[1] = %+v want %+v", backends[1], want)
+	}
+
+	_, err := loadConfig("")
+	if err == nil || !strings.Contains(err.Error(), "backends[1] (animal-crossing): endpoint is required") {
+		t.Errorf("loadConfig() = %v want the malformed VIBES_1 reported", err)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	//Overrides still set from the environment would change the results
+	for _, env := range os.Environ() {
+		if name, _, _ := strings.Cut(env, "="); strings.HasPrefix(name, "VIBES_") {
+			t.Setenv(name, "")
+			os.Unsetenv(name)
+		}
+	}
+
+	//The example leaves the key to the environment
+	if _, err := loadConfig("example_config.json"); err == nil ||
+		!strings.Contains(err.Error(), "set it or VIBES_ANIMAL_CROSSING_ACCESS_KEY") {
+		t.Errorf("loadConfig(example) = %v want the access key missing", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(path, []byte(`{"backends": [
+		{"name": "animal-crossing", "scheme": "https", "endpoint": "vibes.example.com"},
+		{"name": "cafe", "scheme": "https", "endpoint": "cafe.example.com", "access_key": "key",
+			"username": "cafe", "password": "latte", "display_name": "Cafe"}
+	]}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("VIBES_ANIMAL_CROSSING_ACCESS_KEY", "secret")
+	t.Setenv("VIBES_ANIMAL_CROSSING_SCHEME", "http")
+	t.Setenv("VIBES_ANIMAL_CROSSING_ENDPOINT", "localhost:8080")
+	t.Setenv("VIBES_USERNAME", "user")
+	t.Setenv("VIBES_PASSWORD", "hunter2")
+	t.Setenv("VIBES_CAFE_PASSWORD", "mocha")
+
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []backendConfig{
+		{
+			Name: "animal-crossing", Scheme: "http", Endpoint: "localhost:8080",
+			AccessKey: "secret", Username: "user", Password: "hunter2",
+			DisplayName: "animal-crossing",
+		},
+		{
+			Name: "cafe", Scheme: "https", Endpoint: "cafe.example.com",
+			AccessKey: "key", Username: "cafe", Password: "mocha", DisplayName: "Cafe",
+		},
+	}
+	for i := range want {
+		if cfg.Backends[i] != want[i] {
+			t.Errorf("backends[%d] = %+v want %+v", i, cfg.Backends[i], want[i])
+		}
+	}
+
+	if err := os.WriteFile(path, []byte(`{"backends": [], "extra": 1}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfig(path); err == nil || !strings.Contains(err.Error(), "extra") {
+		t.Errorf("loadConfig() with an unknown field = %v want it reported", err)
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/sardap/vibes/bot/store"
+)
+
+//Custom IDs of the control panel's components
+const (
+	controlStop       = "controls_stop"
+	controlSkip       = "controls_skip"
+	controlWacky      = "controls_wacky"
+	controlVolumeUp   = "controls_volume_up"
+	controlVolumeDown = "controls_volume_down"
+	controlBell       = "controls_bell"
+	controlSet        = "controls_set"
+)
+
+const (
+	//volumeStep is how much the volume buttons change the music volume by
+	volumeStep = 10
+	//maxSelectOptions is the most options discord allows in a select menu
+	maxSelectOptions = 25
+)
+
+//controlAction changes the guild's session returning a message saying what
+//it did, info and record are updated in place so the panel shows the change
+type controlAction func(
+	s *discordgo.Session, i *discordgo.InteractionCreate, info *guildInfo, record *store.Session,
+) string
+
+//controlHandlers returns the control panel's handlers by custom ID
+func controlHandlers() map[string]handlerFunc {
+	return map[string]handlerFunc{
+		controlStop:       controlCmd(stopControl),
+		controlSkip:       controlCmd(skipControl),
+		controlWacky:      controlCmd(wackyControl),
+		controlVolumeUp:   controlCmd(volumeControl(volumeStep)),
+		controlVolumeDown: controlCmd(volumeControl(-volumeStep)),
+		controlBell:       controlCmd(bellControl),
+		controlSet:        controlCmd(setControl),
+	}
+}
+
+//toggleStyle is green for things which are on
+func toggleStyle(on bool) discordgo.ButtonStyle {
+	if on {
+		return discordgo.SuccessButton
+	}
+
+	return discordgo.SecondaryButton
+}
+
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+
+	return "off"
+}
+
+//controlComponents are the control panel for the session in record
+func controlComponents(info *guildInfo, record store.Session) []discordgo.MessageComponent {
+	backends := currentBackends.Load()
+	options := make([]discordgo.SelectMenuOption, 0, len(backends.keys))
+	for _, key := range backends.keys {
+		if len(options) == maxSelectOptions {
+			break
+		}
+		v := backends.sets[key]
+		description := v.description
+		if description == "" {
+			description = v.command
+		}
+		if len(description) > maxChoiceLength {
+			description = description[:maxChoiceLength]
+		}
+		options = append(options, discordgo.SelectMenuOption{
+			Label:       v.displayName,
+			Value:       key,
+			Description: description,
+			Default:     key == record.Backend,
+		})
+	}
+
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.Button{Label: "stop", Style: discordgo.DangerButton, CustomID: controlStop},
+			discordgo.Button{Label: "next set", Style: discordgo.PrimaryButton, CustomID: controlSkip},
+			discordgo.Button{
+				Label:    "wacky " + onOff(record.Wacky),
+				Style:    toggleStyle(record.Wacky),
+				CustomID: controlWacky,
+			},
+		}},
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.Button{
+				Label:    "quieter",
+				Style:    discordgo.SecondaryButton,
+				CustomID: controlVolumeDown,
+				Disabled: info.Preferences.Volume <= 0,
+			},
+			discordgo.Button{
+				Label:    "louder",
+				Style:    discordgo.SecondaryButton,
+				CustomID: controlVolumeUp,
+				Disabled: info.Preferences.Volume >= store.MaxVolume,
+			},
+			discordgo.Button{
+				Label:    "bell " + onOff(info.Preferences.Bell),
+				Style:    toggleStyle(info.Preferences.Bell),
+				CustomID: controlBell,
+			},
+		}},
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.SelectMenu{
+				MenuType:    discordgo.StringSelectMenu,
+				CustomID:    controlSet,
+				Placeholder: "pick a set",
+				Options:     options,
+			},
+		}},
+	}
+}
+
+//controlCmd runs action against the guild's session then redraws the panel,
+//the panel is taken away once nothing is playing
+func controlCmd(action controlAction) handlerFunc {
+	return func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		//Switching sets has to join voice which can take longer than discord
+		//waits for an answer
+		err := respond(s, i, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseDeferredMessageUpdate,
+		})
+		if err != nil {
+			log.Printf("%s unable to acknowledge control: %v\n", i.ID, err)
+			return
+		}
+
+		message := "no vibes are happening right now"
+		components := []discordgo.MessageComponent{}
+		info := getGuildInfo(i.GuildID)
+		record, ok := sessionRecord(i.GuildID)
+		if info != nil && ok && sessions.get(i.GuildID) != nil {
+			message = action(s, i, info, &record)
+			if sessions.get(i.GuildID) != nil {
+				components = controlComponents(info, record)
+			}
+		}
+
+		s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+			Content:    &message,
+			Components: &components,
+		})
+	}
+}
+
+func stopControl(
+	s *discordgo.Session, i *discordgo.InteractionCreate, info *guildInfo, record *store.Session,
+) string {
+	sessions.stop(i.GuildID)
+	return "ok vibes stopped"
+}
+
+//switchBackend starts playing the named backend in the session's channel
+func switchBackend(s *discordgo.Session, guildID string, record *store.Session, name string) string {
+	v, ok := currentBackends.Load().sets[name]
+	if !ok {
+		return fmt.Sprintf("%s isn't a music set anymore", name)
+	}
+
+	record.Backend, record.Random, record.Reroll = name, false, false
+	if sess := sessions.get(guildID); sess != nil {
+		record.ChannelID = sess.channel()
+	}
+	if err := startSession(s, guildID, *record); err != nil {
+		log.Printf("%s unable to switch to %s: %v\n", guildID, name, err)
+		return startErrorMessage(err)
+	}
+
+	return vibingMessage(v.command)
+}
+
+//skipControl moves on to the set after the current one
+func skipControl(
+	s *discordgo.Session, i *discordgo.InteractionCreate, info *guildInfo, record *store.Session,
+) string {
+	keys := currentBackends.Load().keys
+	if len(keys) == 0 {
+		return "there are no music sets to play"
+	}
+
+	next := keys[0]
+	for idx, key := range keys {
+		if key == record.Backend {
+			next = keys[(idx+1)%len(keys)]
+			break
+		}
+	}
+
+	return switchBackend(s, i.GuildID, record, next)
+}
+
+//setControl plays the set picked from the menu
+func setControl(
+	s *discordgo.Session, i *discordgo.InteractionCreate, info *guildInfo, record *store.Session,
+) string {
+	values := i.MessageComponentData().Values
+	if len(values) == 0 {
+		return "pick a set to play"
+	}
+
+	return switchBackend(s, i.GuildID, record, values[0])
+}
+
+//wackyControl flips wacky for the session, it's kept in the session record
+//which the session reads when the track restarts
+func wackyControl(
+	s *discordgo.Session, i *discordgo.InteractionCreate, info *guildInfo, record *store.Session,
+) string {
+	record.Wacky = !record.Wacky
+	saveSessionRecord(i.GuildID, *record)
+	sessions.restartTrack(i.GuildID)
+
+	return fmt.Sprintf("wacky is %s", onOff(record.Wacky))
+}
+
+//volumeControl changes the music volume by step
+func volumeControl(step int) controlAction {
+	return func(
+		s *discordgo.Session, i *discordgo.InteractionCreate, info *guildInfo, record *store.Session,
+	) string {
+		prefs := &info.Preferences
+		prefs.Volume += step
+		if prefs.Volume < 0 {
+			prefs.Volume = 0
+		}
+		if prefs.Volume > store.MaxVolume {
+			prefs.Volume = store.MaxVolume
+		}
+		if err := setGuildInfo(i.GuildID, *info); err != nil {
+			return "Unable to save to DB"
+		}
+		sessions.restartTrack(i.GuildID)
+
+		return fmt.Sprintf("music is at %d%%", prefs.Volume)
+	}
+}
+
+//bellControl turns the bell on or off for the guild
+func bellControl(
+	s *discordgo.Session, i *discordgo.InteractionCreate, info *guildInfo, record *store.Session,
+) string {
+	info.Preferences.Bell = !info.Preferences.Bell
+	if err := setGuildInfo(i.GuildID, *info); err != nil {
+		return "Unable to save to DB"
+	}
+	sessions.restartTrack(i.GuildID)
+
+	return fmt.Sprintf("bell is %s", onOff(info.Preferences.Bell))
+}
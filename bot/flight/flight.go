@@ -0,0 +1,89 @@
+//Package flight shares a call between everyone asking for the same key at
+//the same time. It's like singleflight except the call is cancelled once
+//nobody is waiting for it, so a guild stopping stops the download it
+//started unless another guild still wants it.
+package flight
+
+import (
+	"context"
+	"sync"
+)
+
+type call[T any] struct {
+	done    chan struct{}
+	val     T
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+//Group runs calls by key, the zero value is ready to use
+type Group[T any] struct {
+	//Base is the context every call runs under, background when nil
+	Base context.Context
+
+	mu    sync.Mutex
+	calls map[string]*call[T]
+}
+
+//Do returns the result of fn for key, joining the call already running for
+//key if there is one. The ctx fn is given is cancelled once every caller
+//waiting on it has given up, callers giving up get their ctx's error.
+func (g *Group[T]) Do(
+	ctx context.Context, key string, fn func(ctx context.Context) (T, error),
+) (T, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call[T])
+	}
+	c, ok := g.calls[key]
+	if !ok {
+		base := g.Base
+		if base == nil {
+			base = context.Background()
+		}
+		callCtx, cancel := context.WithCancel(base)
+		c = &call[T]{done: make(chan struct{}), cancel: cancel}
+		g.calls[key] = c
+
+		go func() {
+			c.val, c.err = fn(callCtx)
+			cancel()
+			g.forget(key, c)
+			close(c.done)
+		}()
+	}
+	c.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.val, c.err
+	case <-ctx.Done():
+	}
+
+	g.mu.Lock()
+	c.waiters--
+	if c.waiters == 0 {
+		c.cancel()
+		//Anyone asking from now on gets a fresh call rather than joining
+		//one which is being cancelled
+		if g.calls[key] == c {
+			delete(g.calls, key)
+		}
+	}
+	g.mu.Unlock()
+
+	var zero T
+	return zero, ctx.Err()
+}
+
+//forget removes the call if it's still the one for key
+func (g *Group[T]) forget(key string, c *call[T]) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.calls[key] == c {
+		delete(g.calls, key)
+	}
+}
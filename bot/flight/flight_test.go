@@ -0,0 +1,185 @@
+package flight
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+//blocking returns a call which reports starting then waits for release or
+//its ctx to be done
+func blocking(
+	started chan<- string, release <-chan struct{},
+) func(ctx context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		started <- "started"
+		select {
+		case <-release:
+			return "done", nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+}
+
+//waitFor waits until n callers are waiting on key
+func waitFor(g *Group[string], key string, n int) {
+	for {
+		g.mu.Lock()
+		waiters := g.calls[key].waiters
+		g.mu.Unlock()
+		if waiters == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+type result struct {
+	val string
+	err error
+}
+
+func TestDoShares(t *testing.T) {
+	var g Group[string]
+	started := make(chan string, 10)
+	release := make(chan struct{})
+	fn := blocking(started, release)
+
+	results := make(chan result, 3)
+	do := func() {
+		val, err := g.Do(context.Background(), "key", fn)
+		results <- result{val, err}
+	}
+	go do()
+	<-started
+	go do()
+	go do()
+	//Wait for both to join before letting the call finish
+	waitFor(&g, "key", 3)
+	close(release)
+
+	for i := 0; i < 3; i++ {
+		if r := <-results; r.val != "done" || r.err != nil {
+			t.Errorf("got %q %v", r.val, r.err)
+		}
+	}
+	if len(started) != 0 {
+		t.Errorf("fn ran %d more times", len(started))
+	}
+
+	//Finished calls aren't shared with later callers
+	val, err := g.Do(context.Background(), "key", func(ctx context.Context) (string, error) {
+		return "again", nil
+	})
+	if val != "again" || err != nil {
+		t.Errorf("later call got %q %v", val, err)
+	}
+}
+
+func TestDoKeys(t *testing.T) {
+	var g Group[string]
+	for _, key := range []string{"a", "b"} {
+		val, err := g.Do(context.Background(), key, func(ctx context.Context) (string, error) {
+			return key, nil
+		})
+		if val != key || err != nil {
+			t.Errorf("%s got %q %v", key, val, err)
+		}
+	}
+
+	want := errors.New("failed")
+	_, err := g.Do(context.Background(), "c", func(ctx context.Context) (string, error) {
+		return "", want
+	})
+	if err != want {
+		t.Errorf("got %v want %v", err, want)
+	}
+}
+
+func TestDoCancel(t *testing.T) {
+	tests := []struct {
+		name string
+		//callers is how many callers join, cancelled is how many of them
+		//give up
+		callers   int
+		cancelled int
+		//wantCancelled is if fn should see its ctx cancelled
+		wantCancelled bool
+	}{
+		{"only caller gives up", 1, 1, true},
+		{"one of two gives up", 2, 1, false},
+		{"everyone gives up", 3, 3, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var g Group[string]
+			started := make(chan string, 1)
+			release := make(chan struct{})
+			callDone := make(chan error, 1)
+			fn := func(ctx context.Context) (string, error) {
+				val, err := blocking(started, release)(ctx)
+				callDone <- err
+				return val, err
+			}
+
+			results := make(chan result, test.callers)
+			cancels := make([]context.CancelFunc, test.callers)
+			for i := 0; i < test.callers; i++ {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancels[i] = cancel
+				go func() {
+					val, err := g.Do(ctx, "key", fn)
+					results <- result{val, err}
+				}()
+				if i == 0 {
+					<-started
+				}
+			}
+			waitFor(&g, "key", test.callers)
+
+			for i := 0; i < test.cancelled; i++ {
+				cancels[i]()
+				if r := <-results; !errors.Is(r.err, context.Canceled) {
+					t.Errorf("cancelled caller got %q %v", r.val, r.err)
+				}
+			}
+
+			if test.wantCancelled {
+				if err := <-callDone; !errors.Is(err, context.Canceled) {
+					t.Errorf("fn finished with %v want it cancelled", err)
+				}
+				return
+			}
+
+			close(release)
+			if err := <-callDone; err != nil {
+				t.Errorf("fn was cancelled while someone was waiting: %v", err)
+			}
+			for i := test.cancelled; i < test.callers; i++ {
+				if r := <-results; r.val != "done" || r.err != nil {
+					t.Errorf("remaining caller got %q %v", r.val, r.err)
+				}
+			}
+		})
+	}
+}
+
+func TestDoBase(t *testing.T) {
+	base, cancel := context.WithCancel(context.Background())
+	g := Group[string]{Base: base}
+	started := make(chan string, 1)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := g.Do(context.Background(), "key", blocking(started, nil))
+		done <- err
+	}()
+	<-started
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelling Base gave %v", err)
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/sardap/vibes/bot/clock"
+	"github.com/sardap/vibes/bot/flight"
+	"github.com/sardap/vibes/bot/vibes"
+)
+
+//frameKey identifies a sample, every guild playing the same sample shares
+//its download whatever volume they play it at
+type frameKey struct {
+	endpoint string
+	set      string
+	hour     int
+	variant  string
+}
+
+func (k frameKey) String() string {
+	return fmt.Sprintf("%s/%s/%d/%s", k.endpoint, k.set, k.hour, k.variant)
+}
+
+//bellKey is the key for the bell of the backend at endpoint
+func bellKey(endpoint string) frameKey {
+	return frameKey{endpoint: endpoint, set: "bell", hour: -1}
+}
+
+//frameCacheEntry is a downloaded sample and its encodes by volume
+type frameCacheEntry struct {
+	key     frameKey
+	fetched time.Time
+	source  []byte
+	encoded map[int]*encodedAudio
+}
+
+func (e *frameCacheEntry) size() int64 {
+	result := int64(len(e.source))
+	for _, audio := range e.encoded {
+		result += audio.size()
+	}
+
+	return result
+}
+
+//frameCache holds samples and their encoded audio in memory so each sample
+//is only downloaded once no matter how many guilds are playing it, and only
+//encoded once for each volume it's played at. Samples older than maxAge are
+//downloaded again so the backend gets to revalidate them.
+type frameCache struct {
+	maxBytes int64
+	maxAge   time.Duration
+	clock    clock.Clock
+	//encode turns a sample into audio at volume
+	encode func(ctx context.Context, source io.Reader, volume int) (*encodedAudio, error)
+	//cancel kills every download and encode on shutdown
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	entries map[frameKey]*list.Element
+	lru     *list.List
+	size    int64
+	fetches flight.Group[[]byte]
+	encodes flight.Group[*encodedAudio]
+}
+
+func newFrameCache(maxBytes int64, maxAge time.Duration) *frameCache {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &frameCache{
+		maxBytes: maxBytes,
+		maxAge:   maxAge,
+		clock:    clock.Real{},
+		encode:   encodeVolume,
+		cancel:   cancel,
+		entries:  make(map[frameKey]*list.Element),
+		lru:      list.New(),
+		fetches:  flight.Group[[]byte]{Base: ctx},
+		encodes:  flight.Group[*encodedAudio]{Base: ctx},
+	}
+}
+
+//encodeVolume encodes source at volume, a percentage of the normal volume
+func encodeVolume(ctx context.Context, source io.Reader, volume int) (*encodedAudio, error) {
+	return encodeAudio(ctx, source, encodeOptions(volume))
+}
+
+//close kills any downloads or encodes still running
+func (c *frameCache) close() {
+	c.cancel()
+}
+
+//lookup returns the cached sample for key and its encode at volume, either
+//can be nil
+func (c *frameCache) lookup(key frameKey, volume int) ([]byte, *encodedAudio) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	entry := elem.Value.(*frameCacheEntry)
+	if c.expired(entry) {
+		//Anyone still playing it keeps their reference
+		c.remove(elem)
+		return nil, nil
+	}
+	c.lru.MoveToFront(elem)
+
+	return entry.source, entry.encoded[volume]
+}
+
+func (c *frameCache) expired(entry *frameCacheEntry) bool {
+	return c.maxAge > 0 && c.clock.Now().Sub(entry.fetched) >= c.maxAge
+}
+
+//remove drops elem from the cache, c.mu must be held
+func (c *frameCache) remove(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*frameCacheEntry)
+	delete(c.entries, entry.key)
+	c.size -= entry.size()
+}
+
+//store caches the sample for key along with its encode at volume if audio
+//isn't nil. Encodes are only kept while the sample they were made from is
+//still the cached one, it may have expired and changed while encoding.
+func (c *frameCache) store(key frameKey, source []byte, volume int, audio *encodedAudio) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if ok && c.expired(elem.Value.(*frameCacheEntry)) {
+		c.remove(elem)
+		ok = false
+	}
+	if audio != nil && (!ok || !bytes.Equal(elem.Value.(*frameCacheEntry).source, source)) {
+		return
+	}
+	if !ok {
+		elem = c.lru.PushFront(&frameCacheEntry{
+			key:     key,
+			fetched: c.clock.Now(),
+			source:  source,
+			encoded: make(map[int]*encodedAudio),
+		})
+		c.entries[key] = elem
+		c.size += int64(len(source))
+	}
+	c.lru.MoveToFront(elem)
+	entry := elem.Value.(*frameCacheEntry)
+	if audio != nil {
+		if previous, ok := entry.encoded[volume]; ok {
+			c.size -= previous.size()
+		}
+		entry.encoded[volume] = audio
+		c.size += audio.size()
+	}
+
+	//Anyone still playing evicted audio keeps their reference
+	for c.maxBytes > 0 && c.size > c.maxBytes && c.lru.Len() > 1 {
+		c.remove(c.lru.Back())
+	}
+}
+
+//fetch returns the sample for key downloading it with open if it's not
+//cached, concurrent callers for the same key share one download which is
+//only stopped once all of them have given up
+func (c *frameCache) fetch(
+	ctx context.Context, key frameKey,
+	open func(ctx context.Context) (io.ReadCloser, error),
+) ([]byte, error) {
+	if source, _ := c.lookup(key, 0); source != nil {
+		return source, nil
+	}
+
+	return c.fetches.Do(ctx, key.String(), func(ctx context.Context) ([]byte, error) {
+		//It might have been stored after the lookup by the last download
+		if source, _ := c.lookup(key, 0); source != nil {
+			return source, nil
+		}
+
+		stream, err := open(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer stream.Close()
+
+		source, err := io.ReadAll(stream)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			var backendErr *vibes.Error
+			if errors.As(err, &backendErr) {
+				return nil, err
+			}
+			return nil, encodeError(err)
+		}
+		c.store(key, source, 0, nil)
+
+		return source, nil
+	})
+}
+
+//get returns the sample for key encoded at volume, a percentage of the
+//normal volume. The download is shared by everyone getting key and the
+//encode by everyone getting it at the same volume.
+func (c *frameCache) get(
+	ctx context.Context, key frameKey, volume int,
+	open func(ctx context.Context) (io.ReadCloser, error),
+) (*encodedAudio, error) {
+	if _, audio := c.lookup(key, volume); audio != nil {
+		return audio, nil
+	}
+
+	source, err := c.fetch(ctx, key, open)
+	if err != nil {
+		return nil, err
+	}
+
+	name := fmt.Sprintf("%s@%d", key, volume)
+	return c.encodes.Do(ctx, name, func(ctx context.Context) (*encodedAudio, error) {
+		if _, audio := c.lookup(key, volume); audio != nil {
+			return audio, nil
+		}
+
+		audio, err := c.encode(ctx, bytes.NewReader(source), volume)
+		if err != nil {
+			return nil, err
+		}
+		c.store(key, source, volume, audio)
+
+		return audio, nil
+	})
+}
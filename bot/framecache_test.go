@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sardap/vibes/bot/clock"
+)
+
+//countingOpen returns an open for the frame cache that counts how many times
+//it's called, each download returns body
+func countingOpen(body string, calls *int) func(ctx context.Context) (io.ReadCloser, error) {
+	return func(ctx context.Context) (io.ReadCloser, error) {
+		*calls++
+		return io.NopCloser(strings.NewReader(body)), nil
+	}
+}
+
+func TestFrameCacheExpiry(t *testing.T) {
+	fake := clock.NewFake(time.Date(2021, 1, 2, 13, 0, 0, 0, time.UTC))
+	c := newFrameCache(0, 10*time.Minute)
+	c.clock = fake
+	key := frameKey{endpoint: "vibes", set: "cafe", hour: 13, variant: "rain"}
+	audio := &encodedAudio{frames: [][]byte{[]byte("frame")}}
+
+	calls := 0
+	if _, err := c.fetch(context.Background(), key, countingOpen("old", &calls)); err != nil {
+		t.Fatal(err)
+	}
+	c.store(key, []byte("old"), 100, audio)
+
+	fake.Advance(10*time.Minute - time.Second)
+	source, err := c.fetch(context.Background(), key, countingOpen("new", &calls))
+	if err != nil || string(source) != "old" || calls != 1 {
+		t.Fatalf("fetch() before max age = %q %v after %d downloads want old after 1", source, err, calls)
+	}
+
+	fake.Advance(time.Second)
+	if _, cached := c.lookup(key, 100); cached != nil {
+		t.Error("expired encode still cached")
+	}
+	source, err = c.fetch(context.Background(), key, countingOpen("new", &calls))
+	if err != nil || string(source) != "new" || calls != 2 {
+		t.Fatalf("fetch() at max age = %q %v after %d downloads want new after 2", source, err, calls)
+	}
+
+	//An encode of the old sample finishing late isn't kept with the new one
+	c.store(key, []byte("old"), 100, audio)
+	if _, cached := c.lookup(key, 100); cached != nil {
+		t.Error("encode of the expired sample cached with the new one")
+	}
+}
+
+//countingEncode is a frameCache encode that counts encodes by volume, the
+//audio is one frame holding the volume and the source
+type countingEncode struct {
+	mu     sync.Mutex
+	counts map[int]int
+}
+
+func (e *countingEncode) encode(ctx context.Context, source io.Reader, volume int) (*encodedAudio, error) {
+	b, err := io.ReadAll(source)
+	if err != nil {
+		return nil, err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.counts == nil {
+		e.counts = make(map[int]int)
+	}
+	e.counts[volume]++
+
+	return &encodedAudio{frames: [][]byte{[]byte(fmt.Sprintf("%d %s", volume, b))}}, nil
+}
+
+func TestFrameCacheShared(t *testing.T) {
+	c := newFrameCache(0, 0)
+	encoder := &countingEncode{}
+	c.encode = encoder.encode
+	key := frameKey{endpoint: "vibes", set: "cafe", hour: 13, variant: "none"}
+
+	var mu sync.Mutex
+	downloads := 0
+	release := make(chan struct{})
+	open := func(ctx context.Context) (io.ReadCloser, error) {
+		mu.Lock()
+		downloads++
+		mu.Unlock()
+		<-release
+		return io.NopCloser(strings.NewReader("cafe")), nil
+	}
+
+	//Guilds at two volumes all starting the same sample at once
+	volumes := []int{100, 50, 100, 50, 100, 50, 100, 50}
+	results := make([]*encodedAudio, len(volumes))
+	var wg sync.WaitGroup
+	for idx, volume := range volumes {
+		wg.Add(1)
+		go func(idx, volume int) {
+			defer wg.Done()
+			audio, err := c.get(context.Background(), key, volume, open)
+			if err != nil {
+				t.Errorf("get(%d) = %v", volume, err)
+			}
+			results[idx] = audio
+		}(idx, volume)
+	}
+	close(release)
+	wg.Wait()
+
+	if downloads != 1 {
+		t.Errorf("downloaded %d times want once for every volume", downloads)
+	}
+	for _, volume := range []int{100, 50} {
+		if encoder.counts[volume] != 1 {
+			t.Errorf("encoded %d times at %d want once", encoder.counts[volume], volume)
+		}
+	}
+	for idx, audio := range results {
+		want := fmt.Sprintf("%d cafe", volumes[idx])
+		if audio == nil || string(audio.frames[0]) != want || audio != results[idx%2] {
+			t.Errorf("guild %d got %v want the shared %q", idx, audio, want)
+		}
+	}
+
+	//Another volume later still shares the download
+	if _, err := c.get(context.Background(), key, 30, open); err != nil {
+		t.Fatal(err)
+	}
+	if downloads != 1 || encoder.counts[30] != 1 {
+		t.Errorf("new volume took %d downloads and %d encodes want 1 and 1", downloads, encoder.counts[30])
+	}
+}
+
+func TestFrameCacheEviction(t *testing.T) {
+	//Room for one sample and its encode, "cafe" and "100 cafe" are 12 bytes
+	c := newFrameCache(20, 0)
+	c.encode = (&countingEncode{}).encode
+	keys := []frameKey{
+		{endpoint: "vibes", set: "cafe", hour: 1},
+		{endpoint: "vibes", set: "cafe", hour: 2},
+		{endpoint: "vibes", set: "cafe", hour: 3},
+	}
+
+	calls := 0
+	open := countingOpen("cafe", &calls)
+	for _, key := range keys[:2] {
+		if _, err := c.get(context.Background(), key, 100, open); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, audio := c.lookup(keys[0], 100); audio != nil {
+		t.Error("oldest sample wasn't evicted")
+	}
+	if _, audio := c.lookup(keys[1], 100); audio == nil {
+		t.Error("newest sample was evicted")
+	}
+	if c.size != 12 {
+		t.Errorf("size = %d want 12 for the one sample left", c.size)
+	}
+
+	//A sample bigger than the whole cache is still kept while it's playing
+	big := newFrameCache(1, 0)
+	big.encode = (&countingEncode{}).encode
+	if _, err := big.get(context.Background(), keys[2], 100, open); err != nil {
+		t.Fatal(err)
+	}
+	if _, audio := big.lookup(keys[2], 100); audio == nil {
+		t.Error("only sample was evicted")
+	}
+	if calls != 3 {
+		t.Errorf("downloaded %d times want 3", calls)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/jonas747/dca"
+	"github.com/sardap/vibes/bot/vibes"
+)
+
+//encodedAudio is a sample which has been fully encoded into opus frames
+type encodedAudio struct {
+	frames        [][]byte
+	frameDuration time.Duration
+}
+
+//sourceReader remembers why reading the source failed, ffmpeg just sees the
+//input end early. It's read from dca's goroutine.
+type sourceReader struct {
+	r   io.Reader
+	mu  sync.Mutex
+	err error
+}
+
+func (s *sourceReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if err != nil && err != io.EOF {
+		s.mu.Lock()
+		s.err = err
+		s.mu.Unlock()
+	}
+
+	return n, err
+}
+
+func (s *sourceReader) failure() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.err
+}
+
+//encodeError is a failure part way through encoding, a transient stream
+//error so the session waits for it to clear up rather than ending
+func encodeError(err error) error {
+	return &vibes.Error{Kind: vibes.ErrStream, Err: err}
+}
+
+//encodeAudio reads everything from r and encodes it, failures reading r or
+//encoding it are returned as a transient *vibes.Error
+func encodeAudio(
+	ctx context.Context, r io.Reader, options *dca.EncodeOptions,
+) (*encodedAudio, error) {
+	source := &sourceReader{r: r}
+	session, err := dca.EncodeMem(source, options)
+	if err != nil {
+		return nil, encodeError(err)
+	}
+	defer session.Cleanup()
+	//Kill ffmpeg rather than letting it finish if nobody wants the result
+	stop := context.AfterFunc(ctx, func() { session.Stop() })
+	defer stop()
+
+	result := &encodedAudio{frameDuration: session.FrameDuration()}
+	for {
+		frame, err := session.OpusFrame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, encodeError(err)
+		}
+		result.frames = append(result.frames, frame)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	//Reading the source failing is the cause of anything ffmpeg says
+	if err := source.failure(); err != nil {
+		var backendErr *vibes.Error
+		if errors.As(err, &backendErr) {
+			return nil, err
+		}
+		return nil, encodeError(err)
+	}
+	if err := session.Error(); err != nil {
+		return nil, encodeError(err)
+	}
+
+	return result, nil
+}
+
+//length is how long the audio plays for
+func (e *encodedAudio) length() time.Duration {
+	return time.Duration(len(e.frames)) * e.frameDuration
+}
+
+//reader returns a dca.OpusReader starting offset into the audio
+func (e *encodedAudio) reader(offset time.Duration) *frameReader {
+	pos := int(offset / e.frameDuration)
+	if pos > len(e.frames) {
+		pos = len(e.frames)
+	}
+	if pos < 0 {
+		pos = 0
+	}
+
+	return &frameReader{audio: e, pos: pos}
+}
+
+type frameReader struct {
+	audio *encodedAudio
+	pos   int
+}
+
+func (f *frameReader) OpusFrame() ([]byte, error) {
+	if f.pos >= len(f.audio.frames) {
+		return nil, io.EOF
+	}
+
+	f.pos++
+	return f.audio.frames[f.pos-1], nil
+}
+
+func (f *frameReader) FrameDuration() time.Duration {
+	return f.audio.frameDuration
+}
+
+//size is roughly how much memory the frames take up
+func (e *encodedAudio) size() int64 {
+	var result int64
+	for _, frame := range e.frames {
+		result += int64(len(frame))
+	}
+
+	return result
+}
@@ -0,0 +1,270 @@
+//Package geo has the countries, cities and timezones guilds can be setup
+//with, the data is embedded from the IANA zone.tab and iso3166.tab files
+//plus a list of major cities which don't have their own zone
+package geo
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+//go:embed data/*.json
+var dataFS embed.FS
+
+//Country is an ISO 3166 country
+type Country struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+//City is a city the weather backend should know about
+type City struct {
+	Name    string `json:"name"`
+	Country string `json:"country"`
+	Zone    string `json:"zone"`
+}
+
+//Zone is an IANA timezone and the country it's used in
+type Zone struct {
+	Zone    string `json:"zone"`
+	Country string `json:"country"`
+}
+
+var (
+	countries []Country
+	cities    []City
+	zones     []Zone
+
+	countryByCode = make(map[string]Country)
+	zoneByName    = make(map[string]Zone)
+)
+
+func init() {
+	load("data/countries.json", &countries)
+	load("data/cities.json", &cities)
+	load("data/zones.json", &zones)
+
+	for _, c := range countries {
+		countryByCode[c.Code] = c
+	}
+	for _, z := range zones {
+		zoneByName[z.Zone] = z
+	}
+}
+
+func load(path string, v interface{}) {
+	b, err := dataFS.ReadFile(path)
+	if err != nil {
+		panic(err)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		panic(fmt.Sprintf("bad embedded %s: %v", path, err))
+	}
+}
+
+//LookupCountry finds a country by its two letter code in any case
+func LookupCountry(code string) (Country, bool) {
+	c, ok := countryByCode[strings.ToUpper(strings.TrimSpace(code))]
+	return c, ok
+}
+
+//LookupCity finds every city with the name in any case
+func LookupCity(name string) []City {
+	name = strings.TrimSpace(name)
+	result := make([]City, 0)
+	for _, c := range cities {
+		if strings.EqualFold(c.Name, name) {
+			result = append(result, c)
+		}
+	}
+
+	return result
+}
+
+//LookupZone finds a zone by name, only canonical zones tied to a country
+//are known so aliases like US/Eastern aren't found
+func LookupZone(name string) (Zone, bool) {
+	z, ok := zoneByName[strings.TrimSpace(name)]
+	return z, ok
+}
+
+//rank orders how well query matches str, lower is better and -1 is no match
+func rank(str, query string) int {
+	str = strings.ToLower(str)
+	switch {
+	case query == "":
+		return 2
+	case str == query:
+		return 0
+	case strings.HasPrefix(str, query):
+		return 1
+	case strings.Contains(str, query):
+		return 2
+	}
+
+	return -1
+}
+
+type ranked struct {
+	rank  int
+	value string
+	index int
+}
+
+func best(matches []ranked, limit int) []int {
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].rank != matches[j].rank {
+			return matches[i].rank < matches[j].rank
+		}
+		return matches[i].value < matches[j].value
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	result := make([]int, len(matches))
+	for i, m := range matches {
+		result[i] = m.index
+	}
+	return result
+}
+
+//SearchCountries returns up to limit countries whose code or name matches
+//query best matches first
+func SearchCountries(query string, limit int) []Country {
+	query = strings.ToLower(strings.TrimSpace(query))
+	matches := make([]ranked, 0)
+	for i, c := range countries {
+		r := rank(c.Name, query)
+		if codeRank := rank(c.Code, query); codeRank >= 0 && (r < 0 || codeRank < r) {
+			r = codeRank
+		}
+		if r >= 0 {
+			matches = append(matches, ranked{r, c.Name, i})
+		}
+	}
+
+	result := make([]Country, 0)
+	for _, i := range best(matches, limit) {
+		result = append(result, countries[i])
+	}
+	return result
+}
+
+//SearchCities returns up to limit cities matching query, limited to
+//country unless it's empty
+func SearchCities(country, query string, limit int) []City {
+	country = strings.ToUpper(strings.TrimSpace(country))
+	query = strings.ToLower(strings.TrimSpace(query))
+	matches := make([]ranked, 0)
+	for i, c := range cities {
+		if country != "" && c.Country != country {
+			continue
+		}
+		if r := rank(c.Name, query); r >= 0 {
+			matches = append(matches, ranked{r, c.Name, i})
+		}
+	}
+
+	result := make([]City, 0)
+	for _, i := range best(matches, limit) {
+		result = append(result, cities[i])
+	}
+	return result
+}
+
+//SearchZones returns up to limit zones matching query, limited to country
+//unless it's empty
+func SearchZones(country, query string, limit int) []Zone {
+	country = strings.ToUpper(strings.TrimSpace(country))
+	query = strings.ToLower(strings.TrimSpace(query))
+	matches := make([]ranked, 0)
+	for i, z := range zones {
+		if country != "" && z.Country != country {
+			continue
+		}
+		//Match New York as well as New_York
+		r := rank(strings.ReplaceAll(z.Zone, "_", " "), strings.ReplaceAll(query, "_", " "))
+		if r >= 0 {
+			matches = append(matches, ranked{r, z.Zone, i})
+		}
+	}
+
+	result := make([]Zone, 0)
+	for _, i := range best(matches, limit) {
+		result = append(result, zones[i])
+	}
+	return result
+}
+
+//Validate checks the country, city and zone make sense together, zone is
+//skipped if empty for guilds using a fixed offset. Cities and zones which
+//aren't in the dataset are allowed since it only has the major ones.
+func Validate(country, city, zone string) error {
+	c, ok := LookupCountry(country)
+	if !ok {
+		suggestions := SearchCountries(country, 3)
+		if len(suggestions) > 0 {
+			return fmt.Errorf(
+				"%s isn't a country code, did you mean %s (%s)?",
+				country, suggestions[0].Code, suggestions[0].Name,
+			)
+		}
+		return fmt.Errorf("%s isn't a two letter country code like US", country)
+	}
+
+	var z Zone
+	zoneKnown := false
+	if zone != "" {
+		z, zoneKnown = LookupZone(zone)
+		if zoneKnown && z.Country != c.Code {
+			other, _ := LookupCountry(z.Country)
+			return fmt.Errorf(
+				"%s is a timezone in %s not %s, try one of %s",
+				zone, other.Name, c.Name, zoneNames(SearchZones(c.Code, "", 3)),
+			)
+		}
+	}
+
+	known := LookupCity(city)
+	if len(known) == 0 {
+		return nil
+	}
+
+	for _, k := range known {
+		if k.Country != c.Code {
+			continue
+		}
+		if zoneKnown && k.Zone != z.Zone {
+			//Another city with the same name might match
+			continue
+		}
+		return nil
+	}
+
+	for _, k := range known {
+		if k.Country == c.Code {
+			return fmt.Errorf(
+				"%s uses the timezone %s not %s", k.Name, k.Zone, zone,
+			)
+		}
+	}
+
+	other, _ := LookupCountry(known[0].Country)
+	return fmt.Errorf(
+		"%s is in %s (%s) not %s (%s)",
+		known[0].Name, other.Name, other.Code, c.Name, c.Code,
+	)
+}
+
+func zoneNames(zones []Zone) string {
+	names := make([]string, len(zones))
+	for i, z := range zones {
+		names[i] = z.Zone
+	}
+
+	return strings.Join(names, ", ")
+}
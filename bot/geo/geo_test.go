@@ -0,0 +1,104 @@
+package geo
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		country string
+		city    string
+		zone    string
+		//wantErr is part of the error expected, empty for none
+		wantErr string
+	}{
+		{name: "city and zone", country: "AU", city: "Sydney", zone: "Australia/Sydney"},
+		{name: "any case", country: "au", city: "sYDNEY", zone: "Australia/Sydney"},
+		{name: "fixed offset", country: "US", city: "new york"},
+		{name: "unknown city", country: "AU", city: "Wagga Wagga", zone: "Australia/Sydney"},
+		{name: "unknown zone", country: "AU", city: "Wagga Wagga", zone: "Australia/Canberra"},
+		{
+			name:    "city in another zone of the country",
+			country: "US",
+			city:    "Portland",
+			zone:    "America/Los_Angeles",
+		},
+		{name: "bad country", country: "ZZ", city: "sydney", wantErr: "isn't a"},
+		{name: "country name", country: "Australia", city: "sydney", wantErr: "did you mean AU"},
+		{
+			name:    "zone in another country",
+			country: "NZ",
+			city:    "",
+			zone:    "Australia/Sydney",
+			wantErr: "is a timezone in Australia",
+		},
+		{
+			name:    "city in another country",
+			country: "NZ",
+			city:    "Sydney",
+			wantErr: "is in Australia (AU) not",
+		},
+		{
+			name:    "city in another zone",
+			country: "AU",
+			city:    "Perth",
+			zone:    "Australia/Sydney",
+			wantErr: "uses the timezone Australia/Perth",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := Validate(test.country, test.city, test.zone)
+			if test.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate failed: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("Validate gave %v want an error with %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestLookups(t *testing.T) {
+	if c, ok := LookupCountry("us"); !ok || c.Code != "US" {
+		t.Errorf("LookupCountry(us) = %+v %v", c, ok)
+	}
+	if _, ok := LookupCountry("USA"); ok {
+		t.Errorf("LookupCountry found USA")
+	}
+	if z, ok := LookupZone("Europe/London"); !ok || z.Country != "GB" {
+		t.Errorf("LookupZone(Europe/London) = %+v %v", z, ok)
+	}
+	if _, ok := LookupZone("US/Eastern"); ok {
+		t.Errorf("LookupZone found the alias US/Eastern")
+	}
+	if cities := LookupCity("LONDON"); len(cities) != 1 || cities[0].Country != "GB" {
+		t.Errorf("LookupCity(LONDON) = %+v", cities)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	countries := SearchCountries("au", 3)
+	if len(countries) == 0 || countries[0].Code != "AU" {
+		t.Errorf("SearchCountries(au) = %+v want AU first", countries)
+	}
+	if got := SearchCountries("", 5); len(got) != 5 {
+		t.Errorf("SearchCountries limited to 5 gave %d", len(got))
+	}
+	for _, city := range SearchCities("AU", "", 25) {
+		if city.Country != "AU" {
+			t.Errorf("SearchCities(AU) gave %+v", city)
+		}
+	}
+	for _, zone := range SearchZones("US", "new", 25) {
+		if zone.Country != "US" || !strings.Contains(strings.ToLower(zone.Zone), "new") {
+			t.Errorf("SearchZones(US, new) gave %+v", zone)
+		}
+	}
+}
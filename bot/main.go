@@ -1,694 +1,1324 @@
-package main
-
-import (
-	"bytes"
-	"context"
-	"encoding/json"
-	"errors"
-	"fmt"
-	"log"
-	"math/rand"
-	"os"
-	"os/signal"
-	"strconv"
-	"strings"
-	"time"
-
-	"github.com/bwmarrin/discordgo"
-	"github.com/jonas747/dca"
-	cmap "github.com/orcaman/concurrent-map"
-	"github.com/sardap/discgov"
-	"github.com/sardap/vibes/bot/vibes"
-	bolt "go.etcd.io/bbolt"
-	"golang.org/x/sync/semaphore"
-)
-
-const (
-	setupVibePattern = "setup ([a-z]{2}) \"(.*?)\" (-?\\d{4})"
-)
-
-var (
-	dbClient       *bolt.DB
-	bucketName     = []byte("guilds")
-	voiceLocks     = cmap.New()
-	defaultOptions = dca.StdEncodeOptions
-)
-
-type vibeInfo struct {
-	command string
-	invoker vibes.Invoker
-}
-
-type commandSet struct {
-	commands map[string]*discordgo.ApplicationCommand
-	handlers map[string]func(s *discordgo.Session, i *discordgo.InteractionCreate)
-}
-
-func init() {
-	rand.Seed(time.Now().UnixNano())
-}
-
-func createCommandSet(s *discordgo.Session) commandSet {
-	defaultOptions.RawOutput = true
-	defaultOptions.Volume = 50
-	defaultOptions.Application = "audio"
-
-	commands := make(map[string]*discordgo.ApplicationCommand)
-
-	commands["setup"] = &discordgo.ApplicationCommand{
-		Name:        "setup",
-		Description: "setup server info in bot db",
-		Options: []*discordgo.ApplicationCommandOption{
-			{
-				Type:        discordgo.ApplicationCommandOptionString,
-				Name:        "country",
-				Description: "US (Country Code)",
-				Required:    true,
-			},
-			{
-				Type:        discordgo.ApplicationCommandOptionString,
-				Name:        "city",
-				Description: "new york",
-				Required:    true,
-			},
-			{
-				Type:        discordgo.ApplicationCommandOptionString,
-				Name:        "time-offset",
-				Description: "-0500",
-				Required:    true,
-			},
-		},
-	}
-
-	commands["info"] = &discordgo.ApplicationCommand{
-		Name:        "info",
-		Description: "get guild info",
-		Options:     []*discordgo.ApplicationCommandOption{},
-	}
-
-	commands["stop"] = &discordgo.ApplicationCommand{
-		Name:        "stop",
-		Description: "stops the vibes",
-		Options:     []*discordgo.ApplicationCommandOption{},
-	}
-
-	commandHandlers := map[string]func(s *discordgo.Session, i *discordgo.InteractionCreate){
-		"setup": setupVibeCmd,
-		"info":  guildInfoCmd,
-		"stop":  stopVibeCmd,
-	}
-
-	var err error
-	dbClient, err = bolt.Open(os.Getenv("DB_PATH"), 0666, nil)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	dbClient.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists(bucketName)
-		return err
-	})
-
-	vibeSets := make(map[string]*vibeInfo)
-	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0)
-
-	i := 0
-	vibesKeys := make([]string, 0)
-	for {
-		str := os.Getenv(fmt.Sprintf("VIBES_%d", i))
-		if str == "" {
-			break
-		}
-
-		splits := strings.Split(str, ",")
-		if len(splits) != 4 {
-			panic("vibe info has wrong number of args")
-		}
-
-		username := os.Getenv("VIBES_USERNAME")
-		password := os.Getenv("VIBES_PASSWORD")
-
-		vibesKeys = append(vibesKeys, splits[0])
-		vibeSets[splits[0]] = &vibeInfo{
-			command: splits[0],
-			invoker: vibes.Invoker{
-				Endpoint:  splits[2],
-				AccessKey: splits[3],
-				Scheme:    splits[1],
-				Username:  username,
-				Password:  password,
-			},
-		}
-
-		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
-			Name:  splits[0],
-			Value: splits[0],
-		})
-
-		i++
-	}
-
-	choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
-		Name:  "random",
-		Value: "random",
-	})
-
-	commands["start"] = &discordgo.ApplicationCommand{
-		Name:        "start",
-		Description: "join channel and start playing music",
-		Options: []*discordgo.ApplicationCommandOption{
-			{
-				Type:        discordgo.ApplicationCommandOptionString,
-				Name:        "set",
-				Description: "select which music set",
-				Required:    true,
-				Choices:     choices,
-			},
-			{
-				Type:        discordgo.ApplicationCommandOptionBoolean,
-				Name:        "wacky",
-				Description: "turn on wacky",
-				Required:    false,
-			},
-		},
-	}
-
-	commandHandlers["start"] = func(s *discordgo.Session, i *discordgo.InteractionCreate) {
-		//Hack becuase this is boned
-		cmd := i.ApplicationCommandData().Options[0].StringValue()
-		log.Printf("Running start command %s\n", cmd)
-		if cmd == "random" {
-			vibeSets[vibesKeys[rand.Intn(len(vibesKeys)-1)]].startVibeCmd(s, i)
-			return
-		}
-
-		for k, v := range vibeSets {
-			if cmd == k {
-				log.Printf("%s Start command matched %s trying to start vibing\n", i.ID, k)
-				err := v.startVibeCmd(s, i)
-				if err != nil {
-					s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-						Type: discordgo.InteractionResponseChannelMessageWithSource,
-						Data: &discordgo.InteractionResponseData{
-							Content: err.Error(),
-						},
-					})
-					log.Printf("%s Error in startVibeCmd:%v\n", i.ID, err)
-				}
-				break
-			}
-		}
-	}
-
-	return commandSet{commands, commandHandlers}
-}
-
-type guildInfo struct {
-	Country string `json:"country"`
-	City    string `json:"city"`
-	Offset  string `json:"offset"`
-}
-
-func getGuildInfo(id string) *guildInfo {
-	var result *guildInfo
-	dbClient.View(func(tx *bolt.Tx) error {
-		val := tx.Bucket(bucketName).Get([]byte(id))
-		if val == nil {
-			result = nil
-			return nil
-		}
-
-		var g guildInfo
-		json.Unmarshal(val, &g)
-		result = &g
-
-		return nil
-	})
-
-	return result
-}
-
-func setGuildInfo(id string, info guildInfo) error {
-	client := dbClient
-	return client.Update(func(tx *bolt.Tx) error {
-		b, _ := json.Marshal(info)
-		return tx.Bucket(bucketName).Put(
-			[]byte(id), []byte(b),
-		)
-	})
-}
-
-type voiceLock struct {
-	lock    *semaphore.Weighted
-	kill    chan bool
-	channel string
-}
-
-func getVoiceLock(gid string) *voiceLock {
-	var result *voiceLock
-	if tmp, ok := voiceLocks.Get(gid); ok {
-		result = tmp.(*voiceLock)
-	}
-
-	return result
-}
-
-func createVoiceLock(gid, cid string) *voiceLock {
-	result := &voiceLock{
-		lock:    semaphore.NewWeighted(1),
-		channel: cid,
-		kill:    make(chan bool),
-	}
-	voiceLocks.Set(gid, result)
-	return result
-}
-
-func deleteVoiceLock(gid string) {
-	voiceLocks.Remove(gid)
-}
-
-func inVoice(gid string) bool {
-	l := getVoiceLock(gid)
-
-	if l == nil {
-		return false
-	}
-
-	if l.lock.TryAcquire(1) {
-		l.lock.Release(1)
-		return false
-	}
-
-	return true
-}
-
-func getUserChannel(guildID, userID string, channels []*discordgo.Channel) (string, error) {
-	for _, channel := range channels {
-		users := discgov.GetUsers(guildID, channel.ID)
-		for _, uid := range users {
-			if uid == userID {
-				return channel.ID, nil
-			}
-		}
-	}
-
-	return "", errors.New("could not find user")
-}
-
-func joinCaller(
-	s *discordgo.Session, i *discordgo.InteractionCreate,
-) (voice *discordgo.VoiceConnection, err error) {
-	guild, err := s.State.Guild(i.GuildID)
-	if err != nil {
-		return nil, fmt.Errorf("could not find your discord server")
-
-	}
-
-	targetChannel, err := getUserChannel(i.GuildID, i.Member.User.ID, guild.Channels)
-	if err != nil {
-		return nil, fmt.Errorf("must be in a channel on the target server to vibe")
-	}
-
-	return s.ChannelVoiceJoin(i.GuildID, targetChannel, false, true)
-}
-
-func offsetTime(offset string) time.Time {
-	offsetHour, _ := strconv.Atoi(offset[:2])
-	offsetMin, _ := strconv.Atoi(offset[1:])
-	if offsetHour < 0 {
-		offsetMin = -offsetMin
-	}
-
-	return time.Now().UTC().Add(
-		time.Duration(offsetHour+1) * time.Hour,
-	).Add(
-		time.Duration(offsetMin) * time.Minute,
-	)
-}
-
-// Gross
-func firstDigit(x int) int {
-	if x < 10 {
-		return 0
-	}
-	str := strconv.Itoa(x)
-	result, _ := strconv.Atoi(string(str[0]))
-	return result
-}
-
-func createSeed(offset string) int64 {
-	t := offsetTime(offset)
-	str := fmt.Sprintf(
-		"%d%d%d%d%d",
-		firstDigit(t.Minute()), t.Hour(), t.Day(), t.Month(), t.Year(),
-	)
-
-	result, _ := strconv.ParseInt(str, 10, 64)
-	fmt.Printf("seed: %s, int: %d\n", str, result)
-	return result
-}
-
-func randomGame(sets []string, offset string) string {
-	rand.Seed(createSeed(offset))
-	defer rand.Seed(time.Now().Unix())
-	return sets[rand.Intn(len(sets))]
-}
-
-func (i *guildInfo) startVibing(
-	invoker vibes.Invoker, v *discordgo.VoiceConnection,
-	g *discordgo.Guild, invert bool,
-) {
-	sets, err := invoker.GetSets()
-	if err != nil {
-		fmt.Printf("ERROR getting sets %s\n", err)
-		return
-	}
-
-	vl := createVoiceLock(v.GuildID, v.ChannelID)
-	vl.lock.Acquire(context.TODO(), 1)
-	defer vl.lock.Release(1)
-	defer deleteVoiceLock(v.GuildID)
-
-	bellPlayed := false
-	lastHour := -1
-	for {
-		//Check if it's the next hour
-		if lastHour != offsetTime(i.Offset).Hour() {
-			bellPlayed = false
-			lastHour = offsetTime(i.Offset).Hour()
-		}
-		err := func() error {
-			vl := getVoiceLock(v.GuildID)
-			if vl == nil {
-				return fmt.Errorf("disconnected")
-			}
-
-			offsetStart := false
-			if !bellPlayed && offsetTime(i.Offset).Minute() == 0 {
-				fmt.Printf("BELL TIME\n")
-				stream, err := invoker.GetBellStream()
-				if err != nil {
-					return err
-				}
-				defer stream.Close()
-				bellPlayed = true
-				encodingSession, err := dca.EncodeMem(stream, defaultOptions)
-				if err != nil {
-					return err
-				}
-
-				v.Speaking(true)
-				done := make(chan error)
-				dca.NewStream(encodingSession, v, done)
-				<-done
-				v.Speaking(false)
-				encodingSession.Cleanup()
-			}
-
-			hour := offsetTime(i.Offset).Hour()
-
-			if invert {
-				if hour >= 12 {
-					hour = hour - 12
-				} else {
-					hour = hour + 12
-				}
-			}
-
-			stream, err := invoker.GetSampleStream(
-				hour, randomGame(sets, i.Offset), i.City, i.Country,
-			)
-			offsetStart = true
-			if err != nil {
-				return err
-			}
-			defer stream.Close()
-
-			options := defaultOptions
-			if offsetStart {
-				var startTime int
-				offsetLeft := offsetTime(i.Offset).Minute() % 10
-				startTime = offsetLeft*60 + offsetTime(i.Offset).Second()
-				options.StartTime = startTime
-			}
-
-			encodingSession, err := dca.EncodeMem(stream, options)
-			if err != nil {
-				return err
-			}
-
-			v.Speaking(true)
-			defer v.Speaking(false)
-			done := make(chan error)
-			dca.NewStream(encodingSession, v, done)
-			defer encodingSession.Cleanup()
-			select {
-			case <-done:
-				break
-			case <-vl.kill:
-				return fmt.Errorf("killing exsiting")
-			}
-
-			return nil
-		}()
-		if err != nil {
-			fmt.Printf("%v\n", err)
-			return
-		}
-	}
-}
-
-func defualtResponse(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-		Type: discordgo.InteractionResponseChannelMessageWithSource,
-		Data: &discordgo.InteractionResponseData{
-			Content: "Processing...",
-		},
-	})
-	if err != nil {
-		log.Fatal(err)
-	}
-}
-
-func setupVibeCmd(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	defualtResponse(s, i)
-
-	country := i.ApplicationCommandData().Options[0].StringValue()
-	city := i.ApplicationCommandData().Options[1].StringValue()
-	timeOffsetStr := i.ApplicationCommandData().Options[2].StringValue()
-
-	offsetHour, err := strconv.Atoi(timeOffsetStr[:2])
-	if err != nil || offsetHour > 14 || offsetHour < -12 {
-		message := "Unable to save to DB"
-		s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
-			Content: &message,
-		})
-		return
-	}
-
-	err = setGuildInfo(i.GuildID, guildInfo{
-		Country: country, City: city, Offset: timeOffsetStr,
-	})
-	if err != nil {
-		message := "Unable to save to DB"
-		s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
-			Content: &message,
-		})
-		return
-	}
-
-	message := "created server info in DB!"
-	_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
-		Content: &message,
-	})
-	if err != nil {
-		log.Fatal(err)
-	}
-}
-
-func guildInfoCmd(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	defualtResponse(s, i)
-
-	info := getGuildInfo(i.GuildID)
-	if info == nil {
-		message := "no sever info in my DB"
-		s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
-			Content: &message,
-		})
-
-		return
-	}
-
-	message := fmt.Sprintf(
-		"info %v\n hour: %d",
-		info, offsetTime(info.Offset).Hour(),
-	)
-	s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
-		Content: &message,
-	})
-}
-
-func (v *vibeInfo) startVibeCmd(s *discordgo.Session, i *discordgo.InteractionCreate) error {
-	log.Printf("%s Start vibing entered\n", i.ID)
-	defualtResponse(s, i)
-
-	var wacky bool
-	if len(i.ApplicationCommandData().Options) > 1 {
-		wacky = i.ApplicationCommandData().Options[1].BoolValue()
-	} else {
-		wacky = false
-	}
-	log.Printf("%s Wacky %v\n", i.ID, wacky)
-
-	if inVoice(i.GuildID) {
-		log.Printf("%s Is currently in voice leaving", i.ID)
-		vl := getVoiceLock(i.GuildID)
-		vl.kill <- true
-		deleteVoiceLock(i.GuildID)
-	}
-
-	log.Printf("%s Getting guild info", i.ID)
-	info := getGuildInfo(i.GuildID)
-	if info == nil {
-		return fmt.Errorf("please setup server info first check help")
-	}
-	log.Printf("%s Guild gotten", i.ID)
-
-	log.Printf("%s Joining call", i.ID)
-	voice, err := joinCaller(s, i)
-	if err != nil {
-		return fmt.Errorf("unable to find you in a channel! Err: %v", err)
-	}
-	log.Printf("%s Joined called", i.ID)
-
-	g, _ := s.Guild(i.GuildID)
-
-	log.Printf("%s STARTING THE VIBING", i.ID)
-	go info.startVibing(v.invoker, voice, g, wacky)
-
-	message := fmt.Sprintf("we %sing now", strings.TrimSuffix(v.command, "e"))
-	s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
-		Content: &message,
-	})
-
-	return nil
-}
-
-func stopVibeCmd(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	defualtResponse(s, i)
-
-	if !inVoice(i.GuildID) {
-		message := "no vibes are happening right now"
-		s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
-			Content: &message,
-		})
-		return
-	}
-
-	deleteVoiceLock(i.GuildID)
-	s.ChannelVoiceJoin(i.GuildID, "", true, true)
-
-	message := "ok vibes stopped"
-	s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
-		Content: &message,
-	})
-}
-
-func voiceStateUpdate(s *discordgo.Session, v *discordgo.VoiceStateUpdate) {
-	discgov.UserVoiceTrackerHandler(s, v)
-
-	if usr, _ := s.User(v.UserID); usr.Bot {
-		return
-	}
-
-	gvi := getVoiceLock(v.GuildID)
-	if gvi == nil {
-		return
-	}
-	if v.UserID == s.State.User.ID {
-		if gvi.channel != v.ChannelID {
-			gvi.channel = v.ChannelID
-		}
-		return
-	}
-
-	if len(discgov.GetUsers(v.GuildID, gvi.channel)) == 0 {
-		s.ChannelVoiceJoin(v.GuildID, "", true, true)
-		deleteVoiceLock(v.GuildID)
-	}
-}
-
-func commandsEqual(a, b *discordgo.ApplicationCommand) bool {
-	aJson, _ := json.Marshal(a.Options)
-	bJson, _ := json.Marshal(b.Options)
-	return a.Name == b.Name && a.Description == b.Description && bytes.Equal(aJson, bJson)
-}
-
-func main() {
-	token := strings.Replace(os.Getenv("DISCORD_AUTH"), "\"", "", -1)
-	s, err := discordgo.New("Bot " + token)
-	if err != nil {
-		log.Fatal("unable to create new discord instance ", err)
-	}
-
-	cs := createCommandSet(s)
-
-	s.AddHandler(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
-		log.Printf("Command gotten %s\n", i.ApplicationCommandData().Name)
-		if h, ok := cs.handlers[i.ApplicationCommandData().Name]; ok {
-			h(s, i)
-		}
-	})
-
-	s.AddHandler(func(s *discordgo.Session, r *discordgo.Ready) {
-		s.UpdateListeningStatus("I use slash commands now")
-		log.Println("Bot is up!")
-	})
-
-	// Register the messageCreate func as a callback for MessageCreate events.
-	s.AddHandler(voiceStateUpdate)
-
-	// Open a websocket connection to Discord and begin listening.
-	if err := s.Open(); err != nil {
-		log.Fatal("error opening connection,", err)
-	}
-	defer s.Close()
-
-	// Clear existing commands
-	existingCmds, _ := s.ApplicationCommands(s.State.User.ID, "")
-	// delete deleted commandss
-	for _, v := range existingCmds {
-		if _, ok := cs.commands[v.Name]; !ok {
-			err := s.ApplicationCommandDelete(v.ApplicationID, "", v.ID)
-			if err != nil {
-				log.Fatal(err)
-			}
-		}
-	}
-
-	// Edit updated commands
-	for _, v := range existingCmds {
-		cmd := cs.commands[v.Name]
-		if _, ok := cs.commands[v.Name]; ok {
-			if !commandsEqual(v, cmd) {
-				if _, err := s.ApplicationCommandEdit(v.ApplicationID, "", v.ID, cmd); err != nil {
-					log.Fatalf("Cannot edit '%v' command: %v", v.Name, err)
-				}
-			}
-			delete(cs.commands, v.Name)
-		}
-	}
-
-	// Create new commands
-	for _, cmd := range cs.commands {
-		if _, err := s.ApplicationCommandCreate(s.State.User.ID, "", cmd); err != nil {
-			log.Fatalf("Cannot create '%v' command: %v", cmd, err)
-		}
-	}
-
-	// Wait here until CTRL-C or other term signal is received.
-	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, os.Interrupt)
-	<-stop
-	log.Println("Gracefully shutdowning")
-}
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/jonas747/dca"
+	"github.com/sardap/discgov"
+	"github.com/sardap/vibes/bot/clock"
+	"github.com/sardap/vibes/bot/geo"
+	"github.com/sardap/vibes/bot/rotation"
+	"github.com/sardap/vibes/bot/sink"
+	"github.com/sardap/vibes/bot/store"
+	"github.com/sardap/vibes/bot/vibes"
+)
+
+const (
+	setupVibePattern = "setup ([a-z]{2}) \"(.*?)\" (-?\\d{4})"
+	resumeDelay      = 5 * time.Second
+	maxScheduleHours = 12
+	//defaultSampleMaxAge is how long samples are cached before revalidating
+	defaultSampleMaxAge = 10 * time.Minute
+)
+
+var (
+	guildStore     store.GuildStore
+	sessions       = newSessionManager(deleteSessionRecord)
+	defaultOptions = dca.StdEncodeOptions
+	prefetchLead   = 2 * time.Minute
+	frames         = newFrameCache(256*1024*1024, defaultSampleMaxAge)
+	botClock       = clock.Clock(clock.Real{})
+	//Have to be addressable for the command options
+	minScheduleHours = float64(1)
+	minPolicyWindow  = float64(1)
+	minVolume        = float64(0)
+)
+
+type vibeInfo struct {
+	command     string
+	displayName string
+	description string
+	invoker     vibes.Invoker
+}
+
+//commandSet is the commands and the handlers route picks from, components
+//and modals are keyed by custom ID
+type commandSet struct {
+	commands      map[string]*discordgo.ApplicationCommand
+	handlers      map[string]handlerFunc
+	autocompletes map[string]handlerFunc
+	components    map[string]handlerFunc
+	modals        map[string]handlerFunc
+	loader        *backendLoader
+}
+
+//configureEncoder sets the options every sample is encoded with
+func configureEncoder() {
+	defaultOptions.RawOutput = true
+	defaultOptions.Volume = 50
+	defaultOptions.Application = "audio"
+}
+
+func createCommandSet(s *discordgo.Session) commandSet {
+	configureEncoder()
+
+	commands := make(map[string]*discordgo.ApplicationCommand)
+
+	commands["setup"] = &discordgo.ApplicationCommand{
+		Name:        "setup",
+		Description: "setup server info in bot db",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:         discordgo.ApplicationCommandOptionString,
+				Name:         "country",
+				Description:  "US (Country Code)",
+				Required:     true,
+				Autocomplete: true,
+			},
+			{
+				Type:         discordgo.ApplicationCommandOptionString,
+				Name:         "city",
+				Description:  "new york",
+				Required:     true,
+				Autocomplete: true,
+			},
+			{
+				Type:         discordgo.ApplicationCommandOptionString,
+				Name:         "timezone",
+				Description:  "America/New_York",
+				Required:     true,
+				Autocomplete: true,
+			},
+		},
+	}
+
+	commands["info"] = &discordgo.ApplicationCommand{
+		Name:        "info",
+		Description: "get guild info",
+		Options:     []*discordgo.ApplicationCommandOption{},
+	}
+
+	commands["nowplaying"] = &discordgo.ApplicationCommand{
+		Name:        "nowplaying",
+		Description: "show what's playing",
+		Options:     []*discordgo.ApplicationCommandOption{},
+	}
+
+	commands["stop"] = &discordgo.ApplicationCommand{
+		Name:        "stop",
+		Description: "stops the vibes",
+		Options:     []*discordgo.ApplicationCommandOption{},
+	}
+
+	policyChoices := make([]*discordgo.ApplicationCommandOptionChoice, 0)
+	for _, name := range rotation.PolicyNames {
+		policyChoices = append(policyChoices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  name,
+			Value: name,
+		})
+	}
+
+	commands["volume"] = &discordgo.ApplicationCommand{
+		Name:        "volume",
+		Description: "change the volume, leave both out to see it",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionInteger,
+				Name:        "music",
+				Description: "music volume as a percentage",
+				Required:    false,
+				MinValue:    &minVolume,
+				MaxValue:    store.MaxVolume,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionInteger,
+				Name:        "bell",
+				Description: "bell volume as a percentage",
+				Required:    false,
+				MinValue:    &minVolume,
+				MaxValue:    store.MaxVolume,
+			},
+		},
+	}
+
+	commands["policy"] = &discordgo.ApplicationCommand{
+		Name:        "policy",
+		Description: "choose how sets are picked",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "policy",
+				Description: "how to pick sets",
+				Required:    true,
+				Choices:     policyChoices,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionInteger,
+				Name:        "window",
+				Description: "no-repeat: slots before a set can play again",
+				Required:    false,
+				MinValue:    &minPolicyWindow,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "weights",
+				Description: "weighted: case_fans=3,over_time=1",
+				Required:    false,
+			},
+		},
+	}
+
+	commandHandlers := map[string]handlerFunc{
+		"setup":      withOptions(setupVibeCmd),
+		"info":       guildInfoCmd,
+		"nowplaying": nowPlayingCmd,
+		"stop":       stopVibeCmd,
+		"policy":     withOptions(policyCmd),
+		"defaults":   withOptions(defaultsCmd),
+		"volume":     withOptions(volumeCmd),
+	}
+
+	var err error
+	guildStore, err = store.Open(os.Getenv("STORE"), os.Getenv("DB_PATH"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	timeout, err := parseTimeout(os.Getenv("VIBES_TIMEOUT"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if str := os.Getenv("PREFETCH_MINUTES"); str != "" {
+		minutes, err := strconv.Atoi(str)
+		if err != nil {
+			log.Fatalf("invalid PREFETCH_MINUTES %s: %v", str, err)
+		}
+		prefetchLead = time.Duration(minutes) * time.Minute
+	}
+
+	maxAge, err := sampleMaxAge()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	frameMB := int64(256)
+	if str := os.Getenv("FRAME_CACHE_MAX_MB"); str != "" {
+		frameMB, err = strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			log.Fatalf("invalid FRAME_CACHE_MAX_MB %s: %v", str, err)
+		}
+	}
+	//Samples in memory go stale at the same age as the ones on disk
+	frames = newFrameCache(frameMB*1024*1024, maxAge)
+
+	sampleCache, err := createSampleCache(maxAge)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	loader := &backendLoader{
+		path:    os.Getenv("VIBES_CONFIG"),
+		client:  &http.Client{},
+		timeout: timeout,
+		cache:   sampleCache,
+	}
+	if err := loader.load(); err != nil {
+		log.Fatal(err)
+	}
+	for name, cmd := range backendCommands(currentBackends.Load()) {
+		commands[name] = cmd
+	}
+
+	commandHandlers["schedule"] = withOptions(func(
+		s *discordgo.Session, i *discordgo.InteractionCreate, opts scheduleOptions,
+	) {
+		v, ok := currentBackends.Load().sets[opts.Set]
+		if !ok {
+			respondError(s, i, fmt.Sprintf("%s isn't a music set anymore", opts.Set))
+			return
+		}
+		v.scheduleCmd(s, i, opts)
+	})
+
+	commandHandlers["start"] = withOptions(func(
+		s *discordgo.Session, i *discordgo.InteractionCreate, opts startOptions,
+	) {
+		cmd := opts.Set
+		if info := getGuildInfo(i.GuildID); cmd == "" && info != nil {
+			cmd = info.Preferences.DefaultSet
+		}
+		log.Printf("Running start command %s\n", cmd)
+
+		backends := currentBackends.Load()
+		v, ok := backends.sets[cmd]
+		random := cmd == "random"
+		if random && len(backends.keys) > 0 {
+			v, ok = backends.sets[backends.keys[rand.Intn(len(backends.keys))]], true
+			log.Printf("%s Random picked %s\n", i.ID, v.command)
+		}
+		if !ok {
+			message := "there are no music sets to play"
+			if cmd == "" {
+				message = "pick a set or choose a default with /defaults"
+			}
+			respondError(s, i, message)
+			return
+		}
+
+		log.Printf("%s Start command matched %s trying to start vibing\n", i.ID, v.command)
+		reroll := random && opts.Reroll
+		err := v.startVibeCmd(s, i, opts, random, reroll)
+		if err != nil {
+			message := startErrorMessage(err)
+			if random {
+				message = fmt.Sprintf("random picked %s but %s", v.displayName, message)
+			}
+			respondError(s, i, message)
+			log.Printf("%s Error in startVibeCmd:%v\n", i.ID, err)
+		}
+	})
+
+	autocompletes := map[string]handlerFunc{
+		"setup": withOptions(setupAutocomplete),
+	}
+
+	return commandSet{
+		commands:      commands,
+		handlers:      commandHandlers,
+		autocompletes: autocompletes,
+		components:    controlHandlers(),
+		modals:        map[string]handlerFunc{},
+		loader:        loader,
+	}
+}
+
+//backendCommands returns the commands which list the backends as choices
+func backendCommands(b *backendSet) map[string]*discordgo.ApplicationCommand {
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0, len(b.keys)+1)
+	for _, key := range b.keys {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  b.sets[key].displayName,
+			Value: key,
+		})
+	}
+	withRandom := append(choices, &discordgo.ApplicationCommandOptionChoice{
+		Name:  "random",
+		Value: "random",
+	})
+
+	start := &discordgo.ApplicationCommand{
+		Name:        "start",
+		Description: "join channel and start playing music",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "set",
+				Description: "select which music set, defaults to the one set with /defaults",
+				Required:    false,
+				Choices:     withRandom,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionBoolean,
+				Name:        "wacky",
+				Description: "turn on wacky",
+				Required:    false,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionBoolean,
+				Name:        "reroll",
+				Description: "random: pick a new backend every hour",
+				Required:    false,
+			},
+		},
+	}
+
+	schedule := &discordgo.ApplicationCommand{
+		Name:        "schedule",
+		Description: "show which sets are coming up",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "set",
+				Description: "select which music set",
+				Required:    true,
+				Choices:     choices[:len(choices):len(choices)],
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionInteger,
+				Name:        "hours",
+				Description: "how many hours to show",
+				Required:    false,
+				MinValue:    &minScheduleHours,
+				MaxValue:    maxScheduleHours,
+			},
+		},
+	}
+
+	defaults := &discordgo.ApplicationCommand{
+		Name:        "defaults",
+		Description: "choose what /start does when options are left out",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "set",
+				Description: "music set to play",
+				Required:    false,
+				Choices:     withRandom,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionBoolean,
+				Name:        "wacky",
+				Description: "turn on wacky",
+				Required:    false,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionBoolean,
+				Name:        "bell",
+				Description: "play the bell on the hour",
+				Required:    false,
+			},
+		},
+	}
+
+	return map[string]*discordgo.ApplicationCommand{
+		"start":    start,
+		"schedule": schedule,
+		"defaults": defaults,
+	}
+}
+
+//startErrorMessage turns errors from starting into something to show users
+func startErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, vibes.ErrNotFound):
+		return "that music set couldn't be found on the backend"
+	case errors.Is(err, vibes.ErrUnauthorized):
+		return "I'm not allowed to use that backend, ask the bot owner to check its access key"
+	case errors.Is(err, vibes.ErrTimeout):
+		return "the backend took too long to answer, try again in a bit"
+	case errors.Is(err, vibes.ErrServer):
+		return "the backend is having a bad time right now, try again later"
+	case errors.Is(err, vibes.ErrDecode):
+		return "the backend sent back something I couldn't understand"
+	}
+
+	var backendErr *vibes.Error
+	if errors.As(err, &backendErr) {
+		return "unable to reach the backend right now, try again later"
+	}
+
+	return err.Error()
+}
+
+//sampleMaxAge is how long a sample is used before asking the backend if it's
+//changed
+func sampleMaxAge() (time.Duration, error) {
+	str := os.Getenv("SAMPLE_CACHE_MAX_AGE")
+	if str == "" {
+		return defaultSampleMaxAge, nil
+	}
+
+	maxAge, err := time.ParseDuration(str)
+	if err != nil {
+		return 0, fmt.Errorf("invalid SAMPLE_CACHE_MAX_AGE %s: %v", str, err)
+	}
+
+	return maxAge, nil
+}
+
+//createSampleCache returns nil if SAMPLE_CACHE_DIR is not set
+func createSampleCache(maxAge time.Duration) (*vibes.Cache, error) {
+	dir := os.Getenv("SAMPLE_CACHE_DIR")
+	if dir == "" {
+		return nil, nil
+	}
+
+	maxMB := int64(512)
+	if str := os.Getenv("SAMPLE_CACHE_MAX_MB"); str != "" {
+		var err error
+		maxMB, err = strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SAMPLE_CACHE_MAX_MB %s: %v", str, err)
+		}
+	}
+
+	return vibes.NewCache(dir, maxMB*1024*1024, maxAge)
+}
+
+func parseTimeout(str string) (time.Duration, error) {
+	if str == "" {
+		return vibes.DefaultTimeout, nil
+	}
+
+	result, err := time.ParseDuration(str)
+	if err != nil {
+		return 0, fmt.Errorf("invalid VIBES_TIMEOUT %s: %v", str, err)
+	}
+
+	return result, nil
+}
+
+//guildInfo is the guild's stored settings along with the helpers to use them
+type guildInfo struct {
+	store.Guild
+}
+
+//policy returns how the guild picks sets
+func (i *guildInfo) policy() rotation.Policy {
+	result, err := rotation.NewPolicy(i.Policy, i.Weights, i.NoRepeat)
+	if err != nil {
+		log.Printf("bad stored policy %s: %v\n", i.Policy, err)
+		return rotation.Uniform{}
+	}
+
+	return result
+}
+
+//getGuildInfo returns nil if the guild hasn't been setup
+func getGuildInfo(id string) *guildInfo {
+	g, err := guildStore.Guild(id)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			log.Printf("%s unable to get guild info: %v\n", id, err)
+		}
+		return nil
+	}
+
+	return &guildInfo{g}
+}
+
+func setGuildInfo(id string, info guildInfo) error {
+	return guildStore.SetGuild(id, info.Guild)
+}
+
+func getUserChannel(guildID, userID string, channels []*discordgo.Channel) (string, error) {
+	for _, channel := range channels {
+		users := discgov.GetUsers(guildID, channel.ID)
+		for _, uid := range users {
+			if uid == userID {
+				return channel.ID, nil
+			}
+		}
+	}
+
+	return "", errors.New("could not find user")
+}
+
+//callerChannel returns the voice channel the user running the command is in
+func callerChannel(s *discordgo.Session, i *discordgo.InteractionCreate) (string, error) {
+	guild, err := s.State.Guild(i.GuildID)
+	if err != nil {
+		return "", fmt.Errorf("could not find your discord server")
+
+	}
+
+	targetChannel, err := getUserChannel(i.GuildID, i.Member.User.ID, guild.Channels)
+	if err != nil {
+		return "", fmt.Errorf("must be in a channel on the target server to vibe")
+	}
+
+	return targetChannel, nil
+}
+
+//backendChooser returns the backend to play at t along with its sets
+type backendChooser func(ctx context.Context, t time.Time) (*vibeInfo, []string, error)
+
+//hourlyBackend picks the backend for the hour t is in, everyone in the
+//timezone gets the same pick
+func hourlyBackend(keys []string, t time.Time) string {
+	return keys[rotation.Rand(startOfHour(t)).Intn(len(keys))]
+}
+
+//sampleHour is the hour of the sample to play, wacky flips day and night
+func sampleHour(hour int, invert bool) int {
+	if invert {
+		if hour >= 12 {
+			hour = hour - 12
+		} else {
+			hour = hour + 12
+		}
+	}
+
+	return hour
+}
+
+//playAudio writes source to the sink until it's finished or ctx is done
+func playAudio(ctx context.Context, out sink.AudioSink, source dca.OpusReader) error {
+	if err := out.Speaking(true); err != nil {
+		if errors.Is(err, sink.ErrDisconnected) {
+			return errVoiceLost
+		}
+		log.Printf("unable to start speaking: %v\n", err)
+	}
+	defer out.Speaking(false)
+
+	for {
+		frame, err := source.OpusFrame()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := out.WriteFrame(ctx, frame, source.FrameDuration()); err != nil {
+			if errors.Is(err, sink.ErrDisconnected) {
+				return fmt.Errorf("%w: %v", errVoiceLost, err)
+			}
+			return err
+		}
+	}
+}
+
+//encodeOptions returns the encoder options for volume, a percentage of the
+//normal volume
+func encodeOptions(volume int) *dca.EncodeOptions {
+	options := *defaultOptions
+	options.Volume = defaultOptions.Volume * volume / 100
+	return &options
+}
+
+//loadBell returns the encoded bell for the backend
+func loadBell(ctx context.Context, invoker vibes.Invoker, volume int) (*encodedAudio, error) {
+	return frames.get(ctx, bellKey(invoker.Endpoint), volume, invoker.GetBellStreamContext)
+}
+
+//loadSample returns the encoded sample, shared with every other guild
+//getting the same weather variant, along with the variant which is empty if
+//the weather couldn't be found
+func (i *guildInfo) loadSample(
+	ctx context.Context, invoker vibes.Invoker, hour int, set string,
+) (*encodedAudio, string, error) {
+	weather, err := invoker.GetWeatherContext(ctx, i.City, i.Country)
+	if err != nil {
+		if ctx.Err() != nil || vibes.Temporary(err) {
+			return nil, "", err
+		}
+
+		//No telling which variant the backend will send so don't share it
+		log.Printf("unable to get weather for %s %s: %v\n", i.City, i.Country, err)
+		stream, err := invoker.GetSampleStreamContext(ctx, hour, set, i.City, i.Country)
+		if err != nil {
+			return nil, "", err
+		}
+		defer stream.Close()
+		audio, err := encodeAudio(ctx, stream, encodeOptions(i.Preferences.Volume))
+		return audio, "", err
+	}
+
+	//Samples on disk without a variant could be for any weather so they
+	//can't be shared under one
+	variant := weather.Variant()
+	open := func(ctx context.Context) (io.ReadCloser, error) {
+		return invoker.GetSampleVariantStreamContext(ctx, hour, set, i.City, i.Country, variant)
+	}
+	audio, err := frames.get(ctx, frameKey{
+		endpoint: invoker.Endpoint,
+		set:      set,
+		hour:     hour,
+		variant:  variant,
+	}, i.Preferences.Volume, open)
+	return audio, variant, err
+}
+
+func (i *guildInfo) startVibing(
+	ctx context.Context, invoker vibes.Invoker, sets []string,
+	guildID string, out sink.AudioSink, invert bool,
+	reroll backendChooser, restart <-chan struct{}, clk clock.Clock,
+) error {
+	//Sessions call this again after reconnecting so anything started here
+	//has to stop when it returns
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if prefetchLead > 0 {
+		go newPrefetcher(clk, prefetchLead, guildID, invoker, i, sets, invert, reroll).run(ctx)
+	}
+
+	bellPlayed := false
+	lastHour := -1
+	for {
+		//Check if it's the next hour
+		if lastHour != i.localTime(clk).Hour() {
+			if reroll != nil && lastHour != -1 {
+				next, nextSets, err := reroll(ctx, i.localTime(clk))
+				if err != nil {
+					log.Printf("reroll failed keeping current backend: %v\n", err)
+				} else if len(nextSets) > 0 {
+					log.Printf("%s rerolled to %s\n", guildID, next.command)
+					invoker, sets = next.invoker, nextSets
+					saveSessionBackend(guildID, next.command)
+				}
+			}
+			bellPlayed = false
+			lastHour = i.localTime(clk).Hour()
+		}
+		//Restarting cuts the track short to pick up new settings
+		trackCtx, cancelTrack := context.WithCancel(ctx)
+		restarted := make(chan struct{})
+		watching := make(chan struct{})
+		go func() {
+			defer close(watching)
+			select {
+			case <-restart:
+				close(restarted)
+				cancelTrack()
+			case <-trackCtx.Done():
+			}
+		}()
+
+		err := func() error {
+			if i.Preferences.Bell && !bellPlayed && i.localTime(clk).Minute() == 0 {
+				log.Printf("%s bell time\n", guildID)
+				bellPlayed = true
+				bell, err := loadBell(ctx, invoker, i.Preferences.BellVolume)
+				if err != nil {
+					return err
+				}
+				if err := playAudio(trackCtx, out, bell.reader(0)); err != nil {
+					return err
+				}
+			}
+
+			hour := sampleHour(i.localTime(clk).Hour(), invert)
+			set := i.policy().Pick(sets, i.localTime(clk))
+			sample, variant, err := i.loadSample(ctx, invoker, hour, set)
+			if err != nil {
+				return err
+			}
+
+			//Start where everyone else in the timezone is up to
+			offsetLeft := i.localTime(clk).Minute() % 10
+			startTime := time.Duration(offsetLeft*60+i.localTime(clk).Second()) * time.Second
+			sessions.setPlaying(guildID, nowPlaying{
+				invoker: invoker,
+				set:     set,
+				hour:    hour,
+				wacky:   invert,
+				variant: variant,
+				started: clk.Now().Add(-startTime),
+				length:  sample.length(),
+			})
+			if startTime >= sample.length() {
+				//Sample is over wait for the next one
+				select {
+				case <-clk.After(10*time.Minute - startTime):
+				case <-trackCtx.Done():
+					return trackCtx.Err()
+				}
+				return nil
+			}
+
+			if err := playAudio(trackCtx, out, sample.reader(startTime)); err != nil {
+				return err
+			}
+
+			return nil
+		}()
+		cancelTrack()
+		<-watching
+
+		select {
+		case <-restarted:
+			if ctx.Err() == nil {
+				if fresh := getGuildInfo(guildID); fresh != nil {
+					i = fresh
+				}
+				//Wacky can be toggled from the control panel
+				if record, ok := sessionRecord(guildID); ok {
+					invert = record.Wacky
+				}
+				log.Printf("%s restarting track\n", guildID)
+				continue
+			}
+		default:
+		}
+		if err != nil {
+			log.Printf("%s playback failed: %v\n", guildID, err)
+			if ctx.Err() != nil || !vibes.Temporary(err) {
+				return err
+			}
+
+			//Backend is struggling wait for it to come back then keep going
+			select {
+			case <-clk.After(resumeDelay):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			if err := invoker.WaitAvailable(ctx); err != nil {
+				return err
+			}
+			log.Printf("resuming vibes in %s\n", guildID)
+		}
+	}
+}
+
+func defualtResponse(s *discordgo.Session, i *discordgo.InteractionCreate) error {
+	return respond(s, i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: "Processing...",
+		},
+	})
+}
+
+type setupOptions struct {
+	Country  string `option:"country"`
+	City     string `option:"city"`
+	Timezone string `option:"timezone"`
+}
+
+func setupVibeCmd(s *discordgo.Session, i *discordgo.InteractionCreate, opts setupOptions) {
+	if err := defualtResponse(s, i); err != nil {
+		log.Printf("%s unable to respond: %v\n", i.ID, err)
+		return
+	}
+
+	country := strings.ToUpper(strings.TrimSpace(opts.Country))
+	city := strings.TrimSpace(opts.City)
+
+	timezone, offset, err := parseTimezone(opts.Timezone)
+	if err == nil {
+		err = geo.Validate(country, city, timezone)
+	}
+	if err != nil {
+		message := err.Error()
+		s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+			Content: &message,
+		})
+		return
+	}
+
+	//Keep everything else the guild has set
+	info := getGuildInfo(i.GuildID)
+	if info == nil {
+		info = &guildInfo{store.NewGuild()}
+	}
+	info.Country, info.City = country, city
+	info.Offset, info.Timezone = offset, timezone
+
+	err = setGuildInfo(i.GuildID, *info)
+	if err != nil {
+		message := "Unable to save to DB"
+		s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+			Content: &message,
+		})
+		return
+	}
+
+	message := "created server info in DB!"
+	_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Content: &message,
+	})
+	if err != nil {
+		log.Printf("%s unable to say the server info was saved: %v\n", i.ID, err)
+	}
+}
+
+func guildInfoCmd(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if err := defualtResponse(s, i); err != nil {
+		log.Printf("%s unable to respond: %v\n", i.ID, err)
+		return
+	}
+
+	info := getGuildInfo(i.GuildID)
+	if info == nil {
+		message := "no sever info in my DB"
+		s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+			Content: &message,
+		})
+
+		return
+	}
+
+	message := fmt.Sprintf(
+		"info %v\n hour: %d",
+		info, info.localTime(botClock).Hour(),
+	)
+	s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Content: &message,
+	})
+}
+
+//parseWeights parses weights like case_fans=3,over_time=1
+func parseWeights(str string) (map[string]int, error) {
+	result := make(map[string]int)
+	for _, pair := range strings.Split(str, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		splits := strings.Split(pair, "=")
+		if len(splits) != 2 {
+			return nil, fmt.Errorf("%s should look like set=weight", pair)
+		}
+		weight, err := strconv.Atoi(strings.TrimSpace(splits[1]))
+		if err != nil {
+			return nil, fmt.Errorf("weight %s for %s isn't a number", splits[1], splits[0])
+		}
+		result[strings.TrimSpace(splits[0])] = weight
+	}
+
+	return result, nil
+}
+
+type policyOptions struct {
+	Policy  string `option:"policy"`
+	Window  *int   `option:"window"`
+	Weights string `option:"weights"`
+}
+
+func policyCmd(s *discordgo.Session, i *discordgo.InteractionCreate, opts policyOptions) {
+	if err := defualtResponse(s, i); err != nil {
+		log.Printf("%s unable to respond: %v\n", i.ID, err)
+		return
+	}
+
+	message := func() string {
+		info := getGuildInfo(i.GuildID)
+		if info == nil {
+			return "please setup server info first check help"
+		}
+
+		name := opts.Policy
+		window := 2
+		if opts.Window != nil {
+			window = *opts.Window
+		}
+		weights, err := parseWeights(opts.Weights)
+		if err != nil {
+			return err.Error()
+		}
+
+		policy, err := rotation.NewPolicy(name, weights, window)
+		if err != nil {
+			return err.Error()
+		}
+
+		info.Policy = name
+		info.Weights = nil
+		info.NoRepeat = 0
+		switch name {
+		case rotation.WeightedPolicy:
+			info.Weights = weights
+		case rotation.NoRepeatPolicy:
+			info.NoRepeat = window
+		}
+		if err := setGuildInfo(i.GuildID, *info); err != nil {
+			return "Unable to save to DB"
+		}
+
+		return fmt.Sprintf(
+			"sets will be picked with %s from the next /start",
+			rotation.Describe(policy),
+		)
+	}()
+
+	s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Content: &message,
+	})
+}
+
+type defaultsOptions struct {
+	Set   string `option:"set"`
+	Wacky *bool  `option:"wacky"`
+	Bell  *bool  `option:"bell"`
+}
+
+//defaultsCmd sets what /start uses when options are left out
+func defaultsCmd(s *discordgo.Session, i *discordgo.InteractionCreate, opts defaultsOptions) {
+	if err := defualtResponse(s, i); err != nil {
+		log.Printf("%s unable to respond: %v\n", i.ID, err)
+		return
+	}
+
+	message := func() string {
+		info := getGuildInfo(i.GuildID)
+		if info == nil {
+			return "please setup server info first check help"
+		}
+
+		prefs := &info.Preferences
+		if opts.Set != "" {
+			prefs.DefaultSet = opts.Set
+		}
+		if opts.Wacky != nil {
+			prefs.Wacky = *opts.Wacky
+		}
+		if opts.Bell != nil {
+			prefs.Bell = *opts.Bell
+		}
+		if err := setGuildInfo(i.GuildID, *info); err != nil {
+			return "Unable to save to DB"
+		}
+		//The bell is heard straight away like the control panel's button
+		if opts.Bell != nil {
+			sessions.restartTrack(i.GuildID)
+		}
+
+		set := prefs.DefaultSet
+		if set == "" {
+			set = "none"
+		}
+		return fmt.Sprintf(
+			"defaults set: %s wacky: %v bell: %v, the set and wacky apply from the next /start",
+			set, prefs.Wacky, prefs.Bell,
+		)
+	}()
+
+	s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Content: &message,
+	})
+}
+
+type volumeOptions struct {
+	Music *int `option:"music"`
+	Bell  *int `option:"bell"`
+}
+
+//volumeCmd changes the guild's music and bell volume restarting the
+//current track so it's heard straight away
+func volumeCmd(s *discordgo.Session, i *discordgo.InteractionCreate, opts volumeOptions) {
+	if err := defualtResponse(s, i); err != nil {
+		log.Printf("%s unable to respond: %v\n", i.ID, err)
+		return
+	}
+
+	message := func() string {
+		info := getGuildInfo(i.GuildID)
+		if info == nil {
+			return "please setup server info first check help"
+		}
+
+		prefs := &info.Preferences
+		if opts.Music != nil {
+			prefs.Volume = *opts.Music
+		}
+		if opts.Bell != nil {
+			prefs.BellVolume = *opts.Bell
+		}
+		changed := opts.Music != nil || opts.Bell != nil
+
+		current := fmt.Sprintf("music is at %d%% and the bell is at %d%%", prefs.Volume, prefs.BellVolume)
+		if !changed {
+			return current
+		}
+
+		if err := setGuildInfo(i.GuildID, *info); err != nil {
+			return "Unable to save to DB"
+		}
+		if sessions.restartTrack(i.GuildID) {
+			current += ", restarting the track to change it"
+		}
+		return current
+	}()
+
+	s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Content: &message,
+	})
+}
+
+type startOptions struct {
+	Set    string `option:"set"`
+	Wacky  *bool  `option:"wacky"`
+	Reroll bool   `option:"reroll"`
+}
+
+func (v *vibeInfo) startVibeCmd(
+	s *discordgo.Session, i *discordgo.InteractionCreate, opts startOptions,
+	random, reroll bool,
+) error {
+	log.Printf("%s Start vibing entered\n", i.ID)
+	if err := defualtResponse(s, i); err != nil {
+		return fmt.Errorf("unable to respond: %w", err)
+	}
+
+	wacky := false
+	info := getGuildInfo(i.GuildID)
+	if info != nil {
+		wacky = info.Preferences.Wacky
+	}
+	if opts.Wacky != nil {
+		wacky = *opts.Wacky
+	}
+	log.Printf("%s Wacky %v\n", i.ID, wacky)
+
+	channel, err := callerChannel(s, i)
+	if err != nil {
+		return fmt.Errorf("unable to find you in a channel! Err: %v", err)
+	}
+
+	log.Printf("%s Joining call and STARTING THE VIBING", i.ID)
+	record := store.Session{
+		ChannelID: channel,
+		Backend:   v.command,
+		Random:    random,
+		Reroll:    reroll,
+		Wacky:     wacky,
+	}
+	err = startSession(s, i.GuildID, record)
+	if err != nil {
+		return err
+	}
+
+	message := vibingMessage(v.command)
+	if random {
+		message = fmt.Sprintf("random picked %s, %s", v.displayName, message)
+	}
+	if reroll {
+		message += " and I'll pick again every hour"
+	}
+	//startSession fails without guild info so it's there
+	components := controlComponents(info, record)
+	s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Content:    &message,
+		Components: &components,
+	})
+
+	return nil
+}
+
+//vibingMessage is what's said once the backend starts playing
+func vibingMessage(command string) string {
+	return fmt.Sprintf("we %sing now", strings.TrimSuffix(command, "e"))
+}
+
+type scheduleOptions struct {
+	Set   string `option:"set"`
+	Hours *int   `option:"hours"`
+}
+
+//scheduleCmd shows the upcoming rotation in the guild's timezone
+func (v *vibeInfo) scheduleCmd(
+	s *discordgo.Session, i *discordgo.InteractionCreate, opts scheduleOptions,
+) {
+	if err := defualtResponse(s, i); err != nil {
+		log.Printf("%s unable to respond: %v\n", i.ID, err)
+		return
+	}
+
+	hours := 3
+	if opts.Hours != nil {
+		hours = *opts.Hours
+	}
+
+	message := func() string {
+		info := getGuildInfo(i.GuildID)
+		if info == nil {
+			return "please setup server info first check help"
+		}
+
+		sets, err := v.invoker.GetSetsContext(context.Background())
+		if err != nil {
+			log.Printf("%s Error getting sets for schedule:%v\n", i.ID, err)
+			return startErrorMessage(err)
+		}
+		if len(sets) == 0 {
+			return "the backend doesn't have any music sets"
+		}
+
+		slots := rotation.Schedule(info.policy(), sets, info.localTime(botClock), hours*6)
+		var b strings.Builder
+		fmt.Fprintf(
+			&b, "upcoming %s sets (rotation v%d %s)\n",
+			v.command, rotation.Version, rotation.Describe(info.policy()),
+		)
+		//Squash runs of the same set into one line
+		for start := 0; start < len(slots); {
+			end := start
+			for end+1 < len(slots) && slots[end+1].Set == slots[start].Set {
+				end++
+			}
+			fmt.Fprintf(
+				&b, "`%s-%s` %s\n",
+				slots[start].Start.Format("15:04"), slots[end].End().Format("15:04"),
+				slots[start].Set,
+			)
+			start = end + 1
+		}
+
+		return b.String()
+	}()
+
+	s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Content: &message,
+	})
+}
+
+func stopVibeCmd(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if err := defualtResponse(s, i); err != nil {
+		log.Printf("%s unable to respond: %v\n", i.ID, err)
+		return
+	}
+
+	if !sessions.stop(i.GuildID) {
+		message := "no vibes are happening right now"
+		s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+			Content: &message,
+		})
+		return
+	}
+
+	message := "ok vibes stopped"
+	s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Content: &message,
+	})
+}
+
+func voiceStateUpdate(s *discordgo.Session, v *discordgo.VoiceStateUpdate) {
+	discgov.UserVoiceTrackerHandler(s, v)
+
+	sess := sessions.get(v.GuildID)
+	if sess == nil {
+		return
+	}
+	//Checked before the bot check below which would skip it
+	if v.UserID == s.State.User.ID {
+		if v.ChannelID == "" {
+			//There's no channel to reconnect to so stop for good, unless
+			//this is old news and the bot has joined again since
+			_, err := s.State.VoiceState(v.GuildID, v.UserID)
+			if sess.kicked() && err != nil {
+				log.Printf("%s I was disconnected from voice ending the session\n", v.GuildID)
+				go sess.stop()
+			}
+			return
+		}
+
+		sessions.moved(v.GuildID, v.ChannelID)
+		//Resume where the bot was moved to
+		if record, ok := sessionRecord(v.GuildID); ok && record.ChannelID != v.ChannelID {
+			record.ChannelID = v.ChannelID
+			saveSessionRecord(v.GuildID, record)
+		}
+		return
+	}
+
+	if usr, _ := s.User(v.UserID); usr == nil || usr.Bot {
+		return
+	}
+
+	if len(discgov.GetUsers(v.GuildID, sess.channel())) == 0 {
+		//Don't hold up discord's event loop while it leaves
+		go sessions.stop(v.GuildID)
+	}
+}
+
+func commandsEqual(a, b *discordgo.ApplicationCommand) bool {
+	aJson, _ := json.Marshal(a.Options)
+	bJson, _ := json.Marshal(b.Options)
+	return a.Name == b.Name && a.Description == b.Description && bytes.Equal(aJson, bJson)
+}
+
+//syncCommands makes discord's commands match commands, only sending the
+//ones which have changed
+func syncCommands(s *discordgo.Session, commands map[string]*discordgo.ApplicationCommand) error {
+	existingCmds, err := s.ApplicationCommands(s.State.User.ID, "")
+	if err != nil {
+		return fmt.Errorf("getting commands: %w", err)
+	}
+
+	//delete deleted commandss
+	for _, v := range existingCmds {
+		if _, ok := commands[v.Name]; !ok {
+			if err := s.ApplicationCommandDelete(v.ApplicationID, "", v.ID); err != nil {
+				return fmt.Errorf("cannot delete '%v' command: %w", v.Name, err)
+			}
+		}
+	}
+
+	//Edit updated commands
+	created := make(map[string]bool)
+	for _, v := range existingCmds {
+		if cmd, ok := commands[v.Name]; ok {
+			if !commandsEqual(v, cmd) {
+				if _, err := s.ApplicationCommandEdit(v.ApplicationID, "", v.ID, cmd); err != nil {
+					return fmt.Errorf("cannot edit '%v' command: %w", v.Name, err)
+				}
+			}
+			created[v.Name] = true
+		}
+	}
+
+	//Create new commands
+	for name, cmd := range commands {
+		if created[name] {
+			continue
+		}
+		if _, err := s.ApplicationCommandCreate(s.State.User.ID, "", cmd); err != nil {
+			return fmt.Errorf("cannot create '%v' command: %w", cmd.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "simulate" {
+		if err := simulate(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	token := strings.Replace(os.Getenv("DISCORD_AUTH"), "\"", "", -1)
+	s, err := discordgo.New("Bot " + token)
+	if err != nil {
+		log.Fatal("unable to create new discord instance ", err)
+	}
+
+	cs := createCommandSet(s)
+
+	s.AddHandler(cs.route)
+
+	var resume sync.Once
+	s.AddHandler(func(s *discordgo.Session, r *discordgo.Ready) {
+		s.UpdateListeningStatus("I use slash commands now")
+		log.Println("Bot is up!")
+		//Ready is sent again when the gateway reconnects
+		resume.Do(func() {
+			go func() {
+				//Give discord a moment to send the guilds
+				<-botClock.After(resumeDelay)
+				resumeSessions(s)
+			}()
+		})
+	})
+
+	//Register the messageCreate func as a callback for MessageCreate events.
+	s.AddHandler(voiceStateUpdate)
+
+	//Open a websocket connection to Discord and begin listening.
+	if err := s.Open(); err != nil {
+		log.Fatal("error opening connection,", err)
+	}
+
+	if err := syncCommands(s, cs.commands); err != nil {
+		log.Fatal(err)
+	}
+
+	go watchConfig(s, cs)
+
+	//Wait here until CTRL-C or other term signal is received.
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+	log.Println("Gracefully shutdowning")
+	shutdown(s)
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sardap/vibes/bot/clock"
+	"github.com/sardap/vibes/bot/sink"
+	"github.com/sardap/vibes/bot/store"
+	"github.com/sardap/vibes/bot/vibes"
+)
+
+//testFrameDuration is how long each frame from testEncode plays for
+const testFrameDuration = 20 * time.Second
+
+//testEncode stands in for ffmpeg, a source of "name count" is encoded as
+//count frames of "name #n"
+func testEncode(ctx context.Context, source io.Reader, volume int) (*encodedAudio, error) {
+	b, err := io.ReadAll(source)
+	if err != nil {
+		return nil, err
+	}
+
+	var name string
+	var count int
+	if _, err := fmt.Sscanf(string(b), "%s %d", &name, &count); err != nil {
+		return nil, fmt.Errorf("bad test sample %q: %w", b, err)
+	}
+	result := &encodedAudio{frameDuration: testFrameDuration}
+	for n := 0; n < count; n++ {
+		result.frames = append(result.frames, []byte(fmt.Sprintf("%s #%d", name, n)))
+	}
+
+	return result, nil
+}
+
+//playedFrame is a frame written to a recordingSink and when
+type playedFrame struct {
+	at    time.Time
+	frame string
+}
+
+//recordingSink remembers every frame written to it
+type recordingSink struct {
+	sink.Null
+	clock clock.Clock
+
+	mu     sync.Mutex
+	played []playedFrame
+}
+
+func (r *recordingSink) WriteFrame(ctx context.Context, frame []byte, d time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.played = append(r.played, playedFrame{r.clock.Now(), string(frame)})
+
+	return nil
+}
+
+func (r *recordingSink) frames() []playedFrame {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]playedFrame(nil), r.played...)
+}
+
+func TestStartVibing(t *testing.T) {
+	useMemoryStore(t)
+	previousFrames, previousLead := frames, prefetchLead
+	frames = newFrameCache(0, 0)
+	frames.encode = testEncode
+	//The prefetcher's waits would get in the way of stepping the clock
+	prefetchLead = 0
+	t.Cleanup(func() { frames, prefetchLead = previousFrames, previousLead })
+
+	bodies := map[string]string{
+		"/api/get_weather/au/melbourne":        `{"weather": {"cloud": 0, "raining": 0, "snowing": 0}}`,
+		"/api/get_bell":                        "bell 1",
+		"/api/get_sample/au/melbourne/cafe/13": "cafe_13 30",
+		//Shorter than ten minutes so the start offset can be past its end
+		"/api/get_sample/au/melbourne/cafe/14": "cafe_14 3",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := bodies[r.URL.Path]
+		if !ok {
+			t.Errorf("unexpected request for %s", r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, body)
+	}))
+	defer server.Close()
+	invoker := vibes.Invoker{
+		Endpoint: strings.TrimPrefix(server.URL, "http://"),
+		Scheme:   "http",
+		Client:   server.Client(),
+		Retry:    &vibes.RetryPolicy{MaxAttempts: 1},
+	}
+
+	info := &guildInfo{store.NewGuild()}
+	info.Country, info.City, info.Timezone = "au", "melbourne", "UTC"
+
+	fake := clock.NewFake(time.Date(2021, 1, 2, 13, 53, 20, 0, time.UTC))
+	out := &recordingSink{clock: fake}
+	at := func(hour, minute, second int) time.Time {
+		return time.Date(2021, 1, 2, hour, minute, second, 0, time.UTC)
+	}
+	want := make([]playedFrame, 0)
+	//Starts 3:20 into the ten minute sample like everyone else in the
+	//timezone
+	for n := 10; n < 30; n++ {
+		want = append(want, playedFrame{
+			at(13, 53, 20).Add(time.Duration(n-10) * testFrameDuration), fmt.Sprintf("cafe_13 #%d", n),
+		})
+	}
+	want = append(want,
+		//The bell rings once the hour rolls over
+		playedFrame{at(14, 0, 0), "bell #0"},
+		//The new hour's sample picks up 20 seconds in which the bell took
+		playedFrame{at(14, 0, 20), "cafe_14 #1"},
+		playedFrame{at(14, 0, 40), "cafe_14 #2"},
+		//Nothing plays until the next ten minutes start and no more bells
+		playedFrame{at(14, 10, 0), "cafe_14 #0"},
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- info.startVibing(
+			ctx, invoker, []string{"cafe"}, "guild", sink.Paced(out, fake), false,
+			nil, nil, fake,
+		)
+	}()
+
+	for {
+		fake.BlockUntil(1)
+		if len(out.frames()) >= len(want) {
+			break
+		}
+		if fake.Now().After(at(14, 30, 0)) {
+			t.Fatalf("only played %+v by %s", out.frames(), fake.Now())
+		}
+		fake.Advance(testFrameDuration)
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("startVibing() = %v after being cancelled want %v", err, context.Canceled)
+	}
+
+	played := out.frames()
+	if len(played) != len(want) {
+		t.Fatalf("played %+v want %+v", played, want)
+	}
+	for idx := range want {
+		if !played[idx].at.Equal(want[idx].at) || played[idx].frame != want[idx].frame {
+			t.Errorf("frame %d was %s at %s want %s at %s",
+				idx, played[idx].frame, played[idx].at.Format("15:04:05"),
+				want[idx].frame, want[idx].at.Format("15:04:05"),
+			)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/sardap/vibes/bot/vibes"
+)
+
+//nowPlaying is the track a session is playing
+type nowPlaying struct {
+	invoker vibes.Invoker
+	set     string
+	//hour is the sample's hour which wacky flips
+	hour    int
+	wacky   bool
+	variant string
+	//started is when the start of the sample would have played
+	started time.Time
+	//length is the encoded sample's length
+	length time.Duration
+}
+
+//backendName returns the display name of the backend at endpoint
+func backendName(endpoint string) string {
+	for _, v := range currentBackends.Load().sets {
+		if v.invoker.Endpoint == endpoint {
+			return v.displayName
+		}
+	}
+
+	return endpoint
+}
+
+//sampleLength asks the backend how long samples are falling back to the
+//length of the one playing
+func (p nowPlaying) sampleLength(ctx context.Context) time.Duration {
+	length, err := p.invoker.GetSampleLengthContext(ctx)
+	if err != nil || length <= 0 {
+		if err != nil && !errors.Is(err, vibes.ErrNotFound) {
+			log.Printf("unable to get sample length from %s: %v\n", p.invoker.Endpoint, err)
+		}
+		return p.length
+	}
+
+	return length
+}
+
+//formatPosition formats d like 4:05
+func formatPosition(d time.Duration) string {
+	d = d.Round(time.Second)
+	return fmt.Sprintf("%d:%02d", int(d.Minutes()), int(d.Seconds())%60)
+}
+
+//nowPlayingEmbed describes what's playing for a guild
+func nowPlayingEmbed(info *guildInfo, playing nowPlaying, length time.Duration) *discordgo.MessageEmbed {
+	local := info.localTime(botClock)
+	elapsed := botClock.Now().Sub(playing.started)
+
+	wacky := "off"
+	if playing.wacky {
+		wacky = fmt.Sprintf("on, playing hour %d", playing.hour)
+	}
+	weather := playing.variant
+	if weather == "" {
+		weather = "unknown"
+	}
+	position := fmt.Sprintf("%s / %s", formatPosition(elapsed), formatPosition(length))
+	remaining := formatPosition(length - elapsed)
+	if elapsed >= length {
+		position = "sample is over"
+		remaining = "waiting for the next one"
+	}
+	bell := "off"
+	if info.Preferences.Bell {
+		next := startOfHour(local).Add(time.Hour).Unix()
+		bell = fmt.Sprintf("<t:%d:t> (<t:%d:R>)", next, next)
+	}
+
+	return &discordgo.MessageEmbed{
+		Title: "Now playing",
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Backend", Value: backendName(playing.invoker.Endpoint), Inline: true},
+			{Name: "Set", Value: playing.set, Inline: true},
+			{Name: "Local hour", Value: fmt.Sprintf("%02d:00", local.Hour()), Inline: true},
+			{Name: "Wacky", Value: wacky, Inline: true},
+			{Name: "Weather", Value: weather, Inline: true},
+			{Name: "Position", Value: position, Inline: true},
+			{Name: "Remaining", Value: remaining, Inline: true},
+			{Name: "Next bell", Value: bell, Inline: true},
+		},
+	}
+}
+
+//nowPlayingCmd shows what the guild's session is playing
+func nowPlayingCmd(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if err := defualtResponse(s, i); err != nil {
+		log.Printf("%s unable to respond: %v\n", i.ID, err)
+		return
+	}
+
+	edit := func() *discordgo.WebhookEdit {
+		message := "please setup server info first check help"
+		info := getGuildInfo(i.GuildID)
+		if info == nil {
+			return &discordgo.WebhookEdit{Content: &message}
+		}
+
+		playing, ok := sessions.playing(i.GuildID)
+		if !ok {
+			message = "still getting the first sample ready"
+			if sessions.state(i.GuildID) == stateIdle {
+				message = "no vibes are happening right now"
+			}
+			return &discordgo.WebhookEdit{Content: &message}
+		}
+
+		message = ""
+		embed := nowPlayingEmbed(info, playing, playing.sampleLength(context.Background()))
+		return &discordgo.WebhookEdit{
+			Content: &message,
+			Embeds:  &[]*discordgo.MessageEmbed{embed},
+		}
+	}()
+
+	s.InteractionResponseEdit(i.Interaction, edit)
+}
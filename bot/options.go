@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+//parseOptions fills the fields of dst, a pointer to a struct, from the
+//options named in their option tags. Optional options can be pointer fields
+//which are left nil when the option isn't given.
+func parseOptions(options []*discordgo.ApplicationCommandInteractionDataOption, dst any) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("options go in a pointer to a struct not %T", dst)
+	}
+	v = v.Elem()
+
+	fields := make(map[string]reflect.Value)
+	for n := 0; n < v.NumField(); n++ {
+		if name, ok := v.Type().Field(n).Tag.Lookup("option"); ok {
+			fields[name] = v.Field(n)
+		}
+	}
+
+	for _, opt := range options {
+		field, ok := fields[opt.Name]
+		if !ok {
+			continue
+		}
+		if field.Kind() == reflect.Pointer {
+			value := reflect.New(field.Type().Elem())
+			field.Set(value)
+			field = value.Elem()
+		}
+		if err := setOption(field, opt); err != nil {
+			return fmt.Errorf("option %s: %w", opt.Name, err)
+		}
+	}
+
+	return nil
+}
+
+//setOption sets field to the option's value if it's the right kind
+func setOption(field reflect.Value, opt *discordgo.ApplicationCommandInteractionDataOption) error {
+	switch opt.Type {
+	case discordgo.ApplicationCommandOptionString:
+		if field.Kind() == reflect.String {
+			field.SetString(opt.StringValue())
+			return nil
+		}
+	case discordgo.ApplicationCommandOptionInteger:
+		switch field.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			field.SetInt(opt.IntValue())
+			return nil
+		}
+	case discordgo.ApplicationCommandOptionNumber:
+		if field.Kind() == reflect.Float64 || field.Kind() == reflect.Float32 {
+			field.SetFloat(opt.FloatValue())
+			return nil
+		}
+	case discordgo.ApplicationCommandOptionBoolean:
+		if field.Kind() == reflect.Bool {
+			field.SetBool(opt.BoolValue())
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%s can't go in a %s", opt.Type, field.Type())
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+type testOptions struct {
+	Set     string  `option:"set"`
+	Hour    int     `option:"hour"`
+	Volume  float64 `option:"volume"`
+	Wacky   *bool   `option:"wacky"`
+	Music   *int    `option:"music"`
+	Ignored string
+}
+
+func option(
+	name string, kind discordgo.ApplicationCommandOptionType, value interface{},
+) *discordgo.ApplicationCommandInteractionDataOption {
+	return &discordgo.ApplicationCommandInteractionDataOption{Name: name, Type: kind, Value: value}
+}
+
+func TestParseOptions(t *testing.T) {
+	yes := true
+	fifty := 50
+
+	tests := []struct {
+		name    string
+		options []*discordgo.ApplicationCommandInteractionDataOption
+		want    testOptions
+		wantErr bool
+	}{
+		{name: "none"},
+		{
+			name: "every kind",
+			options: []*discordgo.ApplicationCommandInteractionDataOption{
+				option("set", discordgo.ApplicationCommandOptionString, "cafe"),
+				//Discord sends every number as a float
+				option("hour", discordgo.ApplicationCommandOptionInteger, float64(13)),
+				option("volume", discordgo.ApplicationCommandOptionNumber, 0.5),
+				option("wacky", discordgo.ApplicationCommandOptionBoolean, true),
+				option("music", discordgo.ApplicationCommandOptionInteger, float64(50)),
+			},
+			want: testOptions{Set: "cafe", Hour: 13, Volume: 0.5, Wacky: &yes, Music: &fifty},
+		},
+		{
+			name: "unknown options are skipped",
+			options: []*discordgo.ApplicationCommandInteractionDataOption{
+				option("channel", discordgo.ApplicationCommandOptionString, "general"),
+				option("Ignored", discordgo.ApplicationCommandOptionString, "no tag"),
+			},
+		},
+		{
+			name: "wrong kind",
+			options: []*discordgo.ApplicationCommandInteractionDataOption{
+				option("set", discordgo.ApplicationCommandOptionInteger, float64(1)),
+			},
+			wantErr: true,
+		},
+		{
+			name: "wrong kind for a pointer",
+			options: []*discordgo.ApplicationCommandInteractionDataOption{
+				option("wacky", discordgo.ApplicationCommandOptionString, "yes"),
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got testOptions
+			err := parseOptions(test.options, &got)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("got %+v want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseOptionsDestination(t *testing.T) {
+	var opts testOptions
+	for _, dst := range []interface{}{opts, &opts.Set, nil} {
+		if err := parseOptions(nil, dst); err == nil {
+			t.Errorf("parsing into %T didn't fail", dst)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/sardap/vibes/bot/clock"
+	"github.com/sardap/vibes/bot/vibes"
+)
+
+//prefetcher loads the next hour's sample and the bell into the frame cache
+//ahead of the hour so switching over doesn't leave a gap. The guild's info
+//and wacky are read again each hour so changes since the session started are
+//what gets prefetched, info and invert are used if they can't be loaded.
+type prefetcher struct {
+	clock   clock.Clock
+	lead    time.Duration
+	guildID string
+	invoker vibes.Invoker
+	info    *guildInfo
+	sets    []string
+	invert  bool
+	//reroll picks the backend each hour if set
+	reroll backendChooser
+}
+
+func newPrefetcher(
+	clk clock.Clock, lead time.Duration, guildID string, invoker vibes.Invoker,
+	info *guildInfo, sets []string, invert bool, reroll backendChooser,
+) *prefetcher {
+	return &prefetcher{
+		clock:   clk,
+		lead:    lead,
+		guildID: guildID,
+		invoker: invoker,
+		info:    info,
+		sets:    sets,
+		invert:  invert,
+		reroll:  reroll,
+	}
+}
+
+//current returns the guild's info and whether wacky is on as they are now
+func (p *prefetcher) current() (*guildInfo, bool) {
+	info, invert := p.info, p.invert
+	if fresh := getGuildInfo(p.guildID); fresh != nil {
+		info = fresh
+	}
+	if record, ok := sessionRecord(p.guildID); ok {
+		invert = record.Wacky
+	}
+
+	return info, invert
+}
+
+//run prefetches until ctx is done
+func (p *prefetcher) run(ctx context.Context) {
+	for {
+		info, _ := p.current()
+		now := info.localTime(p.clock)
+		nextHour := startOfHour(now).Add(time.Hour)
+		wait := nextHour.Add(-p.lead).Sub(now)
+		if wait > 0 {
+			select {
+			case <-p.clock.After(wait):
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if err := p.fetch(ctx, nextHour); err != nil {
+			log.Printf("prefetch for %s failed: %v\n", nextHour.Format("15:04"), err)
+		}
+
+		//Don't start on the hour after until this one has started
+		select {
+		case <-p.clock.After(nextHour.Sub(info.localTime(p.clock))):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (p *prefetcher) fetch(ctx context.Context, at time.Time) error {
+	info, invert := p.current()
+	invoker, sets := p.invoker, p.sets
+	if p.reroll != nil {
+		v, rerolledSets, err := p.reroll(ctx, at)
+		if err != nil {
+			return fmt.Errorf("reroll: %w", err)
+		}
+		if len(rerolledSets) == 0 {
+			return fmt.Errorf("reroll: %s doesn't have any music sets", v.command)
+		}
+		invoker, sets = v.invoker, rerolledSets
+	}
+
+	if _, err := loadBell(ctx, invoker, info.Preferences.BellVolume); err != nil {
+		return fmt.Errorf("bell: %w", err)
+	}
+
+	hour := sampleHour(at.Hour(), invert)
+	set := info.policy().Pick(sets, at)
+	if _, _, err := info.loadSample(ctx, invoker, hour, set); err != nil {
+		return fmt.Errorf("set %s hour %d: %w", set, hour, err)
+	}
+	log.Printf("prefetched set %s hour %d\n", set, hour)
+
+	return nil
+}
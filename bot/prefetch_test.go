@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sardap/vibes/bot/clock"
+	"github.com/sardap/vibes/bot/store"
+	"github.com/sardap/vibes/bot/vibes"
+)
+
+//useMemoryStore swaps guildStore for an empty memory store for the rest of
+//the test
+func useMemoryStore(t *testing.T) *store.Memory {
+	memory := store.NewMemory()
+	previous := guildStore
+	guildStore = memory
+	t.Cleanup(func() { guildStore = previous })
+
+	return memory
+}
+
+//prefetchCall is a prefetch reaching the reroll, at is the hour it's for
+type prefetchCall struct {
+	now time.Time
+	at  time.Time
+}
+
+func TestPrefetcherTiming(t *testing.T) {
+	memory := useMemoryStore(t)
+	newYork, _ := time.LoadLocation("America/New_York")
+	kolkata, _ := time.LoadLocation("Asia/Kolkata")
+
+	guild := store.NewGuild()
+	guild.Timezone = "America/New_York"
+	memory.SetGuild("guild", guild)
+
+	fake := clock.NewFake(time.Date(2021, 1, 2, 13, 0, 0, 0, newYork))
+	calls := make(chan prefetchCall)
+	//Failing the reroll stops the prefetch before it fetches anything
+	reroll := func(ctx context.Context, at time.Time) (*vibeInfo, []string, error) {
+		calls <- prefetchCall{fake.Now(), at}
+		return nil, nil, errors.New("no backends in tests")
+	}
+
+	info := getGuildInfo("guild")
+	p := newPrefetcher(
+		fake, time.Minute, "guild", vibes.Invoker{}, info, []string{"cafe"}, false, reroll,
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.run(ctx)
+
+	steps := []struct {
+		name string
+		//change is applied to the guild's record before the step
+		change func(g *store.Guild)
+		//wait is how long until the prefetch is due
+		wait time.Duration
+		at   time.Time
+	}{
+		{
+			name: "lead before the first hour",
+			wait: 59 * time.Minute,
+			at:   time.Date(2021, 1, 2, 14, 0, 0, 0, newYork),
+		},
+		{
+			name: "next hour",
+			wait: 59 * time.Minute,
+			at:   time.Date(2021, 1, 2, 15, 0, 0, 0, newYork),
+		},
+		{
+			//15:00 in New York is 01:30 in Kolkata
+			name:   "timezone changed",
+			change: func(g *store.Guild) { g.Timezone = "Asia/Kolkata" },
+			wait:   29 * time.Minute,
+			at:     time.Date(2021, 1, 3, 2, 0, 0, 0, kolkata),
+		},
+	}
+
+	for i, step := range steps {
+		if step.change != nil {
+			g, _ := memory.Guild("guild")
+			step.change(&g)
+			memory.SetGuild("guild", g)
+		}
+		if i > 0 {
+			//Let the hour the last prefetch was for start
+			fake.BlockUntil(1)
+			fake.Advance(time.Minute)
+		}
+
+		fake.BlockUntil(1)
+		before := fake.Now()
+		fake.Advance(step.wait - time.Second)
+		select {
+		case call := <-calls:
+			t.Fatalf("%s: prefetched %s early at %s", step.name, call.at, call.now)
+		default:
+		}
+		fake.Advance(time.Second)
+
+		call := <-calls
+		if got := call.now.Sub(before); got != step.wait {
+			t.Errorf("%s: prefetched after %s want %s", step.name, got, step.wait)
+		}
+		if !call.at.Equal(step.at) || call.at.Location().String() != step.at.Location().String() {
+			t.Errorf("%s: prefetched for %s want %s", step.name, call.at, step.at)
+		}
+	}
+}
+
+func TestPrefetcherCurrent(t *testing.T) {
+	memory := useMemoryStore(t)
+	fallback := &guildInfo{store.NewGuild()}
+	fallback.Timezone = "UTC"
+	p := newPrefetcher(clock.Real{}, time.Minute, "guild", vibes.Invoker{}, fallback, nil, true, nil)
+
+	//Nothing saved uses what the session started with
+	if info, invert := p.current(); info != fallback || !invert {
+		t.Errorf("current() = %+v %v want the fallback", info, invert)
+	}
+
+	guild := store.NewGuild()
+	guild.Timezone = "Europe/London"
+	guild.Preferences.BellVolume = 30
+	memory.SetGuild("guild", guild)
+	memory.SetSession("guild", store.Session{ChannelID: "channel", Backend: "cafe", Wacky: false})
+
+	info, invert := p.current()
+	if info.Timezone != "Europe/London" || info.Preferences.BellVolume != 30 || invert {
+		t.Errorf("current() = %+v %v want the saved settings", info, invert)
+	}
+}
+
+func TestPrefetcherEmptyReroll(t *testing.T) {
+	useMemoryStore(t)
+	reroll := func(ctx context.Context, at time.Time) (*vibeInfo, []string, error) {
+		return &vibeInfo{command: "empty"}, nil, nil
+	}
+
+	info := &guildInfo{store.NewGuild()}
+	p := newPrefetcher(
+		clock.Real{}, time.Minute, "guild", vibes.Invoker{}, info, []string{"cafe"}, false, reroll,
+	)
+	//A backend with no sets left can't be picked from
+	if err := p.fetch(context.Background(), time.Now()); err == nil {
+		t.Error("fetch() from a backend without sets didn't fail")
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/sardap/vibes/bot/sink"
+	"github.com/sardap/vibes/bot/store"
+)
+
+//saveSessionRecord remembers the session so it can be resumed
+func saveSessionRecord(guildID string, record store.Session) {
+	if err := guildStore.SetSession(guildID, record); err != nil {
+		log.Printf("%s unable to save session record: %v\n", guildID, err)
+	}
+}
+
+//deleteSessionRecord is called once a session ends so it isn't resumed
+func deleteSessionRecord(guildID string) {
+	if err := guildStore.DeleteSession(guildID); err != nil {
+		log.Printf("%s unable to delete session record: %v\n", guildID, err)
+	}
+}
+
+//sessionRecord returns the guild's saved session
+func sessionRecord(guildID string) (store.Session, bool) {
+	records, err := guildStore.Sessions()
+	if err != nil {
+		log.Printf("%s unable to load session record: %v\n", guildID, err)
+		return store.Session{}, false
+	}
+
+	record, ok := records[guildID]
+	return record, ok
+}
+
+//saveSessionBackend records a reroll so a reconnect or resume carries on
+//with the backend that was playing
+func saveSessionBackend(guildID string, backend string) {
+	if record, ok := sessionRecord(guildID); ok && record.Backend != backend {
+		record.Backend = backend
+		saveSessionRecord(guildID, record)
+	}
+}
+
+//rerollBackend is the backendChooser for random sessions which re-roll
+func rerollBackend(ctx context.Context, t time.Time) (*vibeInfo, []string, error) {
+	//Use whatever is configured now in case it's been reloaded
+	backends := currentBackends.Load()
+	return backendSets(ctx, hourlyBackend(backends.keys, t))
+}
+
+//backendSets returns the configured backend called name and its sets
+func backendSets(ctx context.Context, name string) (*vibeInfo, []string, error) {
+	v, ok := currentBackends.Load().sets[name]
+	if !ok {
+		return nil, nil, fmt.Errorf("%s isn't a configured backend", name)
+	}
+
+	sets, err := v.invoker.GetSetsContext(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("getting sets: %w", err)
+	}
+	if len(sets) == 0 {
+		return nil, nil, fmt.Errorf("the backend doesn't have any music sets")
+	}
+
+	return v, sets, nil
+}
+
+//sessionPlay is what a session plays, it's reloaded after reconnecting
+type sessionPlay struct {
+	guildID string
+	record  store.Session
+	info    *guildInfo
+	backend *vibeInfo
+	sets    []string
+}
+
+//reload picks up anything the control panel, settings commands or a reroll
+//changed since the session last connected
+func (p *sessionPlay) reload(ctx context.Context) {
+	if saved, ok := sessionRecord(p.guildID); ok {
+		p.record = saved
+	}
+	if fresh := getGuildInfo(p.guildID); fresh != nil {
+		p.info = fresh
+	}
+	if p.record.Backend == p.backend.command {
+		return
+	}
+
+	backend, sets, err := backendSets(ctx, p.record.Backend)
+	if err != nil {
+		log.Printf("%s keeping %s after reconnecting: %v\n", p.guildID, p.backend.command, err)
+		p.record.Backend = p.backend.command
+		return
+	}
+	p.backend, p.sets = backend, sets
+}
+
+//startSession joins the channel in the record and starts playing, the record
+//is saved once it's playing so it can be resumed
+func startSession(s *discordgo.Session, guildID string, record store.Session) error {
+	if record.ChannelID == "" {
+		return fmt.Errorf("no channel to join")
+	}
+
+	info := getGuildInfo(guildID)
+	if info == nil {
+		return fmt.Errorf("please setup server info first check help")
+	}
+
+	v, sets, err := backendSets(context.Background(), record.Backend)
+	if err != nil {
+		return err
+	}
+
+	var reroll backendChooser
+	if record.Reroll {
+		reroll = rerollBackend
+	}
+
+	play := &sessionPlay{guildID: guildID, record: record, info: info, backend: v, sets: sets}
+	connected := false
+	err = sessions.start(
+		context.Background(), s, guildID, record.ChannelID,
+		func(ctx context.Context, voice *discordgo.VoiceConnection, restart <-chan struct{}) error {
+			if connected {
+				play.reload(ctx)
+			}
+			connected = true
+			saveSessionRecord(guildID, play.record)
+			return play.info.startVibing(
+				ctx, play.backend.invoker, play.sets, guildID, sink.NewDiscord(voice),
+				play.record.Wacky, reroll, restart, botClock,
+			)
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("unable to join your channel: %w", err)
+	}
+
+	return nil
+}
+
+//resumeSessions starts every session which was playing when the bot stopped
+func resumeSessions(s *discordgo.Session) {
+	records, err := guildStore.Sessions()
+	if err != nil {
+		log.Printf("Unable to load sessions to resume: %v\n", err)
+		return
+	}
+
+	for guildID, record := range records {
+		log.Printf("%s resuming %s in %s\n", guildID, record.Backend, record.ChannelID)
+		if err := startSession(s, guildID, record); err != nil {
+			log.Printf("%s unable to resume session: %v\n", guildID, err)
+			if errors.Is(err, errShuttingDown) {
+				return
+			}
+			deleteSessionRecord(guildID)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sardap/vibes/bot/store"
+	"github.com/sardap/vibes/bot/vibes"
+)
+
+//useBackends swaps currentBackends for backends serving sets for the rest of
+//the test, each backend's sets are sent as is
+func useBackends(t *testing.T, sets map[string]string) {
+	result := &backendSet{sets: make(map[string]*vibeInfo)}
+	for name, body := range sets {
+		body := body
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(body))
+		}))
+		t.Cleanup(server.Close)
+
+		result.keys = append(result.keys, name)
+		result.sets[name] = &vibeInfo{
+			command: name,
+			invoker: vibes.Invoker{
+				Endpoint: strings.TrimPrefix(server.URL, "http://"),
+				Scheme:   "http",
+				Client:   server.Client(),
+				Retry:    &vibes.RetryPolicy{MaxAttempts: 1},
+			},
+		}
+	}
+
+	previous := currentBackends.Load()
+	currentBackends.Store(result)
+	t.Cleanup(func() { currentBackends.Store(previous) })
+}
+
+func TestSessionPlayReload(t *testing.T) {
+	memory := useMemoryStore(t)
+	useBackends(t, map[string]string{
+		"cafe":   `["cafe"]`,
+		"animal": `["new_horizons", "wild_world"]`,
+		"empty":  `[]`,
+	})
+
+	guild := store.NewGuild()
+	memory.SetGuild("guild", guild)
+	record := store.Session{ChannelID: "channel", Backend: "cafe", Reroll: true}
+	memory.SetSession("guild", record)
+
+	backend, sets, err := backendSets(context.Background(), "cafe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	play := &sessionPlay{
+		guildID: "guild", record: record, info: getGuildInfo("guild"), backend: backend, sets: sets,
+	}
+
+	//Settings and the backend changed while it was connected
+	guild.Preferences.Volume = 20
+	guild.Timezone = "Europe/London"
+	memory.SetGuild("guild", guild)
+	saveSessionBackend("guild", "animal")
+
+	play.reload(context.Background())
+	if play.info.Preferences.Volume != 20 || play.info.Timezone != "Europe/London" {
+		t.Errorf("reload() kept info %+v want the saved settings", play.info)
+	}
+	if play.backend.command != "animal" || len(play.sets) != 2 || play.record.Backend != "animal" {
+		t.Errorf(
+			"reload() is playing %s %v for %s want the rerolled animal",
+			play.backend.command, play.sets, play.record.Backend,
+		)
+	}
+
+	//Backends that can't be played keep what was playing
+	for _, name := range []string{"empty", "removed"} {
+		record.Backend = name
+		memory.SetSession("guild", record)
+
+		play.reload(context.Background())
+		if play.backend.command != "animal" || len(play.sets) != 2 || play.record.Backend != "animal" {
+			t.Errorf(
+				"reload() with %s is playing %s %v for %s want animal kept",
+				name, play.backend.command, play.sets, play.record.Backend,
+			)
+		}
+	}
+}
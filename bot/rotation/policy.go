@@ -0,0 +1,192 @@
+package rotation
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+//Policy picks the set for the slot t is in, t must be in local time. A
+//policy can only depend on its settings, the sets and the slot so everyone
+//using the same settings agrees.
+type Policy interface {
+	Pick(sets []string, t time.Time) string
+}
+
+//Names of the policies for NewPolicy
+const (
+	UniformPolicy    = "uniform"
+	WeightedPolicy   = "weighted"
+	NoRepeatPolicy   = "no-repeat"
+	RoundRobinPolicy = "round-robin"
+)
+
+//PolicyNames lists every policy NewPolicy knows
+var PolicyNames = []string{
+	UniformPolicy, WeightedPolicy, NoRepeatPolicy, RoundRobinPolicy,
+}
+
+//NewPolicy returns the named policy, an empty name is uniform. weights is
+//only used by weighted and window by no-repeat.
+func NewPolicy(name string, weights map[string]int, window int) (Policy, error) {
+	switch name {
+	case "", UniformPolicy:
+		return Uniform{}, nil
+	case WeightedPolicy:
+		for set, weight := range weights {
+			if weight < 0 {
+				return nil, fmt.Errorf("weight for %s can't be negative", set)
+			}
+		}
+		return Weighted{Weights: weights}, nil
+	case NoRepeatPolicy:
+		if window < 1 {
+			return nil, fmt.Errorf("no-repeat window must be at least 1")
+		}
+		return NoRepeat{Window: window}, nil
+	case RoundRobinPolicy:
+		return RoundRobin{}, nil
+	}
+
+	return nil, fmt.Errorf(
+		"unknown policy %s must be one of %s", name, strings.Join(PolicyNames, ", "),
+	)
+}
+
+//Uniform picks any set with equal chance, it's the version 1 algorithm
+type Uniform struct{}
+
+//Pick returns the set for the slot
+func (Uniform) Pick(sets []string, t time.Time) string {
+	return Pick(sets, t)
+}
+
+//Weighted picks sets in proportion to their weight. Sets without a weight
+//have a weight of 1 and a weight of 0 means never, if every set is 0 it
+//falls back to uniform.
+type Weighted struct {
+	Weights map[string]int
+}
+
+func (w Weighted) weight(set string) int {
+	if weight, ok := w.Weights[set]; ok {
+		return weight
+	}
+
+	return 1
+}
+
+//Pick returns the set for the slot
+func (w Weighted) Pick(sets []string, t time.Time) string {
+	total := 0
+	for _, set := range sets {
+		total += w.weight(set)
+	}
+	if total <= 0 {
+		return Pick(sets, t)
+	}
+
+	//Walk the sets in the backend's order so the pick doesn't depend on
+	//map iteration
+	n := Rand(t).Intn(total)
+	for _, set := range sets {
+		n -= w.weight(set)
+		if n < 0 {
+			return set
+		}
+	}
+
+	return sets[len(sets)-1]
+}
+
+//NoRepeat picks uniformly from the sets which haven't played in the last
+//Window slots. History is worked out from local midnight so it resets each
+//day and the window is capped at one less than the number of sets.
+type NoRepeat struct {
+	Window int
+}
+
+//Pick returns the set for the slot
+func (n NoRepeat) Pick(sets []string, t time.Time) string {
+	window := n.Window
+	if window > len(sets)-1 {
+		window = len(sets) - 1
+	}
+	if window < 1 {
+		return Pick(sets, t)
+	}
+
+	target := SlotStart(t)
+	history := make([]string, 0)
+	var result string
+	for slot := startOfDay(t); !slot.After(target); slot = slot.Add(SlotLength) {
+		recent := history
+		if len(recent) > window {
+			recent = recent[len(recent)-window:]
+		}
+
+		candidates := make([]string, 0, len(sets))
+		for _, set := range sets {
+			if !contains(recent, set) {
+				candidates = append(candidates, set)
+			}
+		}
+
+		result = candidates[Rand(slot).Intn(len(candidates))]
+		history = append(history, result)
+	}
+
+	return result
+}
+
+//RoundRobin plays every set once before playing any again, the order is
+//shuffled each day using the date as the seed
+type RoundRobin struct{}
+
+//Pick returns the set for the slot
+func (RoundRobin) Pick(sets []string, t time.Time) string {
+	day := startOfDay(t)
+	index := int(SlotStart(t).Sub(day) / SlotLength)
+
+	seed := int64(day.Year()*10000 + int(day.Month())*100 + day.Day())
+	order := newRand(seed).Perm(len(sets))
+	return sets[order[index%len(sets)]]
+}
+
+//Describe returns a short human readable summary of the policy
+func Describe(p Policy) string {
+	switch v := p.(type) {
+	case Weighted:
+		sets := make([]string, 0, len(v.Weights))
+		for set := range v.Weights {
+			sets = append(sets, set)
+		}
+		sort.Strings(sets)
+		weights := make([]string, len(sets))
+		for i, set := range sets {
+			weights[i] = fmt.Sprintf("%s=%d", set, v.Weights[set])
+		}
+		return fmt.Sprintf("%s (%s)", WeightedPolicy, strings.Join(weights, ", "))
+	case NoRepeat:
+		return fmt.Sprintf("%s (window %d)", NoRepeatPolicy, v.Window)
+	case RoundRobin:
+		return RoundRobinPolicy
+	}
+
+	return UniformPolicy
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func contains(list []string, str string) bool {
+	for _, s := range list {
+		if s == str {
+			return true
+		}
+	}
+
+	return false
+}
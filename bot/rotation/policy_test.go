@@ -0,0 +1,227 @@
+package rotation
+
+import (
+	"testing"
+	"time"
+)
+
+//day returns every slot start of the day t is in
+func day(t time.Time) []time.Time {
+	result := make([]time.Time, 0)
+	start := startOfDay(t)
+	for slot := start; slot.Day() == start.Day(); slot = slot.Add(SlotLength) {
+		result = append(result, slot)
+	}
+
+	return result
+}
+
+func TestNewPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights map[string]int
+		window  int
+		want    Policy
+		wantErr bool
+	}{
+		{name: "", want: Uniform{}},
+		{name: UniformPolicy, want: Uniform{}},
+		{
+			name:    WeightedPolicy,
+			weights: map[string]int{"alpha": 2},
+			want:    Weighted{Weights: map[string]int{"alpha": 2}},
+		},
+		{name: WeightedPolicy, weights: map[string]int{"alpha": -1}, wantErr: true},
+		{name: NoRepeatPolicy, window: 2, want: NoRepeat{Window: 2}},
+		{name: NoRepeatPolicy, window: 0, wantErr: true},
+		{name: RoundRobinPolicy, want: RoundRobin{}},
+		{name: "shuffle", wantErr: true},
+	}
+
+	for _, test := range tests {
+		p, err := NewPolicy(test.name, test.weights, test.window)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("NewPolicy(%q) gave %v want an error", test.name, p)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("NewPolicy(%q) failed: %v", test.name, err)
+			continue
+		}
+		if Describe(p) != Describe(test.want) {
+			t.Errorf("NewPolicy(%q) = %s want %s", test.name, Describe(p), Describe(test.want))
+		}
+	}
+}
+
+func TestUniformIsVersion1(t *testing.T) {
+	for _, slot := range day(time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		if got, want := (Uniform{}).Pick(sets, slot), sets[Rand(slot).Intn(len(sets))]; got != want {
+			t.Fatalf("uniform picked %s at %s want %s", got, slot, want)
+		}
+	}
+}
+
+func TestWeighted(t *testing.T) {
+	date := time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		weights map[string]int
+		//never are sets which must not be picked
+		never []string
+	}{
+		{"no weights", nil, nil},
+		{"zero weight", map[string]int{"alpha": 0, "gamma": 0}, []string{"alpha", "gamma"}},
+		{
+			"only one",
+			map[string]int{"alpha": 0, "beta": 0, "gamma": 0, "delta": 5},
+			[]string{"alpha", "beta", "gamma"},
+		},
+		{"all zero", map[string]int{"alpha": 0, "beta": 0, "gamma": 0, "delta": 0}, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := Weighted{Weights: test.weights}
+			seen := make(map[string]bool)
+			for _, slot := range day(date) {
+				set := w.Pick(sets, slot)
+				seen[set] = true
+				if contains(test.never, set) {
+					t.Errorf("%s picked at %s with weight 0", set, slot)
+				}
+				if set != w.Pick(sets, slot) {
+					t.Errorf("pick at %s isn't deterministic", slot)
+				}
+			}
+			for _, set := range sets {
+				if !contains(test.never, set) && !seen[set] {
+					t.Errorf("%s never picked in a day", set)
+				}
+			}
+		})
+	}
+
+	//Every weight being zero is the same as uniform
+	w := Weighted{Weights: map[string]int{"alpha": 0, "beta": 0, "gamma": 0, "delta": 0}}
+	for _, slot := range day(date) {
+		if w.Pick(sets, slot) != Pick(sets, slot) {
+			t.Fatalf("all zero weights didn't fall back to uniform at %s", slot)
+		}
+	}
+}
+
+func TestNoRepeat(t *testing.T) {
+	tests := []struct {
+		sets   []string
+		window int
+		//effective is the window after capping
+		effective int
+	}{
+		{sets, 1, 1},
+		{sets, 2, 2},
+		{sets, 3, 3},
+		{sets, 10, 3},
+		{sets[:2], 5, 1},
+		{sets[:1], 3, 0},
+	}
+
+	for _, test := range tests {
+		p := NoRepeat{Window: test.window}
+		for _, date := range []time.Time{
+			time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC),
+			time.Date(2024, 2, 29, 0, 0, 0, 0, time.FixedZone("-0500", -5*60*60)),
+		} {
+			history := make([]string, 0)
+			for _, slot := range day(date) {
+				set := p.Pick(test.sets, slot.Add(7*time.Minute))
+				recent := history
+				if len(recent) > test.effective {
+					recent = recent[len(recent)-test.effective:]
+				}
+				if contains(recent, set) {
+					t.Fatalf(
+						"%d sets window %d picked %s at %s after %v",
+						len(test.sets), test.window, set, slot, recent,
+					)
+				}
+				history = append(history, set)
+			}
+		}
+	}
+}
+
+func TestRoundRobin(t *testing.T) {
+	for _, date := range []time.Time{
+		time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC),
+		time.Date(2021, 1, 3, 0, 0, 0, 0, time.UTC),
+		time.Date(2021, 12, 31, 0, 0, 0, 0, time.FixedZone("+1300", 13*60*60)),
+	} {
+		slots := day(date)
+		var order []string
+		for i := 0; i+len(sets) <= len(slots); i += len(sets) {
+			block := make([]string, 0, len(sets))
+			for _, slot := range slots[i : i+len(sets)] {
+				block = append(block, RoundRobin{}.Pick(sets, slot))
+			}
+
+			//Every set plays once in each block
+			for _, set := range sets {
+				if !contains(block, set) {
+					t.Fatalf("%s missing from %v on %s", set, block, date)
+				}
+			}
+			//and the order is the same all day
+			if order == nil {
+				order = block
+			}
+			for j := range block {
+				if block[j] != order[j] {
+					t.Fatalf("order changed from %v to %v on %s", order, block, date)
+				}
+			}
+		}
+	}
+}
+
+func TestRoundRobinChangesDaily(t *testing.T) {
+	many := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	order := func(date time.Time) string {
+		result := ""
+		for _, slot := range day(date)[:len(many)] {
+			result += RoundRobin{}.Pick(many, slot)
+		}
+		return result
+	}
+
+	first := order(time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC))
+	changed := false
+	for d := 1; d < 7; d++ {
+		if order(time.Date(2021, 1, 2+d, 0, 0, 0, 0, time.UTC)) != first {
+			changed = true
+		}
+	}
+	if !changed {
+		t.Errorf("round robin played %s every day for a week", first)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	tests := []struct {
+		p    Policy
+		want string
+	}{
+		{Uniform{}, "uniform"},
+		{Weighted{Weights: map[string]int{"beta": 0, "alpha": 3}}, "weighted (alpha=3, beta=0)"},
+		{NoRepeat{Window: 3}, "no-repeat (window 3)"},
+		{RoundRobin{}, "round-robin"},
+	}
+
+	for _, test := range tests {
+		if got := Describe(test.p); got != test.want {
+			t.Errorf("Describe(%#v) = %q want %q", test.p, got, test.want)
+		}
+	}
+}
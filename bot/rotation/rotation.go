@@ -0,0 +1,94 @@
+//Package rotation decides which set plays when. Every bot instance using
+//the same version picks the same set for the same local time, so everyone
+//in a timezone hears the same thing without talking to each other.
+//
+//Version 1
+//
+//Local time is split into ten minute slots starting on the hour. A slot's
+//seed is the decimal concatenation of the tens digit of the minute, the
+//hour, the day of the month, the month and the year, none of them zero
+//padded. 14:35 on the 2nd of January 2021 is "3" "14" "2" "1" "2021" giving
+//the seed 314212021. The seed is given to a math/rand source and the set is
+//sets[rand.Intn(len(sets))] using the sets in the order the backend lists
+//them.
+//
+//Changing any of this changes what listeners hear so it needs a new
+//version rather than an edit.
+//
+//Policies
+//
+//Uniform is the algorithm above. The other policies in policy.go are built
+//on the same slots and seeds so they are just as deterministic, listeners
+//only agree if their guilds use the same policy settings.
+package rotation
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+const (
+	//Version of the algorithm implemented here
+	Version = 1
+	//SlotLength is how long each pick lasts
+	SlotLength = 10 * time.Minute
+)
+
+//Slot is a period of time which plays one set
+type Slot struct {
+	Start time.Time
+	Set   string
+}
+
+//End is when the next slot starts
+func (s Slot) End() time.Time {
+	return s.Start.Add(SlotLength)
+}
+
+//SlotStart returns the start of the slot t is in, in t's timezone
+func SlotStart(t time.Time) time.Time {
+	offset := time.Duration(t.Minute()%10)*time.Minute +
+		time.Duration(t.Second())*time.Second +
+		time.Duration(t.Nanosecond())
+	return t.Add(-offset)
+}
+
+//Seed returns the seed for the slot t is in, t must be in local time
+func Seed(t time.Time) int64 {
+	str := fmt.Sprintf(
+		"%d%d%d%d%d",
+		t.Minute()/10, t.Hour(), t.Day(), t.Month(), t.Year(),
+	)
+
+	result, _ := strconv.ParseInt(str, 10, 64)
+	return result
+}
+
+//Rand returns a generator for the slot t is in, anything picked with it is
+//the same for everyone in the timezone
+func Rand(t time.Time) *rand.Rand {
+	return newRand(Seed(t))
+}
+
+func newRand(seed int64) *rand.Rand {
+	return rand.New(rand.NewSource(seed))
+}
+
+//Pick returns the set for the slot t is in, t must be in local time
+func Pick(sets []string, t time.Time) string {
+	return sets[Rand(t).Intn(len(sets))]
+}
+
+//Schedule returns n slots starting with the one from is in picked by p
+func Schedule(p Policy, sets []string, from time.Time, n int) []Slot {
+	result := make([]Slot, 0, n)
+	start := SlotStart(from)
+	for i := 0; i < n; i++ {
+		result = append(result, Slot{Start: start, Set: p.Pick(sets, start)})
+		start = start.Add(SlotLength)
+	}
+
+	return result
+}
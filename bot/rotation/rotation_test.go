@@ -0,0 +1,112 @@
+package rotation
+
+import (
+	"testing"
+	"time"
+)
+
+var sets = []string{"alpha", "beta", "gamma", "delta"}
+
+func TestSeed(t *testing.T) {
+	tests := []struct {
+		name string
+		t    time.Time
+		want int64
+	}{
+		{"documented example", time.Date(2021, 1, 2, 14, 35, 0, 0, time.UTC), 314212021},
+		{"midnight drops leading zeros", time.Date(2000, 1, 1, 0, 5, 0, 0, time.UTC), 112000},
+		{"end of year", time.Date(2022, 12, 31, 23, 59, 59, 0, time.UTC), 52331122022},
+		{"same slot", time.Date(2021, 1, 2, 14, 30, 0, 0, time.UTC), 314212021},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Seed(test.t); got != test.want {
+				t.Errorf("Seed(%s) = %d want %d", test.t, got, test.want)
+			}
+		})
+	}
+}
+
+func TestSlotStart(t *testing.T) {
+	tests := []struct {
+		t    time.Time
+		want time.Time
+	}{
+		{
+			time.Date(2021, 1, 2, 14, 35, 12, 500, time.UTC),
+			time.Date(2021, 1, 2, 14, 30, 0, 0, time.UTC),
+		},
+		{
+			time.Date(2021, 1, 2, 14, 30, 0, 0, time.UTC),
+			time.Date(2021, 1, 2, 14, 30, 0, 0, time.UTC),
+		},
+		{
+			time.Date(2021, 1, 2, 23, 59, 59, 999, time.UTC),
+			time.Date(2021, 1, 2, 23, 50, 0, 0, time.UTC),
+		},
+	}
+
+	for _, test := range tests {
+		if got := SlotStart(test.t); !got.Equal(test.want) {
+			t.Errorf("SlotStart(%s) = %s want %s", test.t, got, test.want)
+		}
+	}
+}
+
+func TestPickUsesLocalTime(t *testing.T) {
+	utc := time.Date(2021, 1, 2, 14, 35, 0, 0, time.UTC)
+	zone := time.FixedZone("+1030", 10*60*60+30*60)
+	local := time.Date(2021, 1, 2, 14, 35, 0, 0, zone)
+
+	//The same wall clock time anywhere picks the same set
+	if Pick(sets, utc) != Pick(sets, local) {
+		t.Errorf("same local time picked different sets")
+	}
+	for i := 0; i < 10; i++ {
+		if Pick(sets, utc) != Pick(sets, utc.Add(time.Duration(i)*time.Second)) {
+			t.Errorf("pick changed within a slot")
+		}
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	from := time.Date(2021, 1, 2, 14, 35, 0, 0, time.UTC)
+	policies := []Policy{Uniform{}, Weighted{}, NoRepeat{Window: 2}, RoundRobin{}}
+
+	for _, p := range policies {
+		t.Run(Describe(p), func(t *testing.T) {
+			slots := Schedule(p, sets, from, 12)
+			if len(slots) != 12 {
+				t.Fatalf("got %d slots want 12", len(slots))
+			}
+
+			start := SlotStart(from)
+			for i, slot := range slots {
+				if !slot.Start.Equal(start) {
+					t.Errorf("slot %d starts %s want %s", i, slot.Start, start)
+				}
+				if !slot.End().Equal(start.Add(SlotLength)) {
+					t.Errorf("slot %d ends %s", i, slot.End())
+				}
+				if want := p.Pick(sets, start); slot.Set != want {
+					t.Errorf("slot %d is %s but the policy picks %s", i, slot.Set, want)
+				}
+				start = start.Add(SlotLength)
+			}
+
+			again := Schedule(p, sets, from.Add(3*time.Minute), 12)
+			for i := range slots {
+				if slots[i] != again[i] {
+					t.Errorf("slot %d changed between runs %v %v", i, slots[i], again[i])
+				}
+			}
+		})
+	}
+}
+
+func TestScheduleEmpty(t *testing.T) {
+	if slots := Schedule(Uniform{}, sets, time.Now(), 0); len(slots) != 0 {
+		t.Errorf("got %d slots want none", len(slots))
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+//errorColour is the red down the side of error embeds
+const errorColour = 0xe74c3c
+
+//responded holds the IDs of interactions being handled which have had their
+//first response, discord only takes one so anything after has to edit it
+var responded sync.Map
+
+//handlerFunc handles an interaction
+type handlerFunc func(s *discordgo.Session, i *discordgo.InteractionCreate)
+
+//route sends the interaction to the handler for its type and name, a
+//handler which panics is recovered and the user is shown an error
+func (cs commandSet) route(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	defer responded.Delete(i.ID)
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("%s handler for %s panicked: %v\n%s", i.ID, interactionName(i), r, debug.Stack())
+			respondError(s, i, "something went wrong doing that, try again")
+		}
+	}()
+
+	var handlers map[string]handlerFunc
+	switch i.Type {
+	case discordgo.InteractionApplicationCommand:
+		handlers = cs.handlers
+	case discordgo.InteractionApplicationCommandAutocomplete:
+		handlers = cs.autocompletes
+	case discordgo.InteractionMessageComponent:
+		handlers = cs.components
+	case discordgo.InteractionModalSubmit:
+		handlers = cs.modals
+	default:
+		log.Printf("%s unknown interaction type %d\n", i.ID, i.Type)
+		return
+	}
+
+	name := interactionName(i)
+	log.Printf("%s %s gotten %s\n", i.ID, i.Type, name)
+	//Autocomplete can't be answered with a message and doesn't change anything
+	if shuttingDown.Load() && i.Type != discordgo.InteractionApplicationCommandAutocomplete {
+		refuseCommand(s, i)
+		return
+	}
+
+	h, ok := handlers[name]
+	if !ok {
+		respondError(s, i, fmt.Sprintf("I don't know how to do %s", name))
+		return
+	}
+	h(s, i)
+}
+
+//interactionName is the command name or custom ID the interaction's handler
+//is keyed by
+func interactionName(i *discordgo.InteractionCreate) string {
+	switch i.Type {
+	case discordgo.InteractionApplicationCommand, discordgo.InteractionApplicationCommandAutocomplete:
+		return i.ApplicationCommandData().Name
+	case discordgo.InteractionMessageComponent:
+		return i.MessageComponentData().CustomID
+	case discordgo.InteractionModalSubmit:
+		return i.ModalSubmitData().CustomID
+	}
+
+	return ""
+}
+
+//withOptions parses the command's options into T for h
+func withOptions[T any](
+	h func(s *discordgo.Session, i *discordgo.InteractionCreate, opts T),
+) handlerFunc {
+	return func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		var opts T
+		if err := parseOptions(i.ApplicationCommandData().Options, &opts); err != nil {
+			log.Printf("%s bad options for %s: %v\n", i.ID, i.ApplicationCommandData().Name, err)
+			respondError(s, i, "I couldn't understand those options")
+			return
+		}
+
+		h(s, i, opts)
+	}
+}
+
+//errorEmbed is how errors are shown to users
+func errorEmbed(message string) *discordgo.MessageEmbed {
+	return &discordgo.MessageEmbed{
+		Title:       "Something went wrong",
+		Description: message,
+		Color:       errorColour,
+	}
+}
+
+//respond sends the interaction's first response remembering it was sent
+func respond(
+	s *discordgo.Session, i *discordgo.InteractionCreate, resp *discordgo.InteractionResponse,
+) error {
+	if err := s.InteractionRespond(i.Interaction, resp); err != nil {
+		return err
+	}
+	responded.Store(i.ID, struct{}{})
+
+	return nil
+}
+
+//respondError shows message in an error embed. Once the handler has
+//responded commands have the response replaced and components get a follow
+//up so the message they're on is left alone.
+func respondError(s *discordgo.Session, i *discordgo.InteractionCreate, message string) {
+	if i.Type == discordgo.InteractionApplicationCommandAutocomplete {
+		autocompleteRespond(s, i, []*discordgo.ApplicationCommandOptionChoice{})
+		return
+	}
+
+	embeds := []*discordgo.MessageEmbed{errorEmbed(message)}
+	var err error
+	if _, ok := responded.Load(i.ID); !ok {
+		err = respond(s, i, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Embeds: embeds,
+				Flags:  discordgo.MessageFlagsEphemeral,
+			},
+		})
+	} else if i.Type == discordgo.InteractionMessageComponent {
+		_, err = s.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
+			Embeds: embeds,
+			Flags:  discordgo.MessageFlagsEphemeral,
+		})
+	} else {
+		empty := ""
+		_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+			Content: &empty,
+			Embeds:  &embeds,
+		})
+	}
+	if err != nil {
+		log.Printf("%s unable to show error %s: %v\n", i.ID, message, err)
+	}
+}
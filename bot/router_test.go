@@ -0,0 +1,174 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+//discordRequest is a request the bot made to discord
+type discordRequest struct {
+	method string
+	path   string
+	body   string
+}
+
+//recordingTransport answers every request to discord with an empty object
+//and remembers it
+type recordingTransport struct {
+	mu       sync.Mutex
+	requests []discordRequest
+}
+
+func (rt *recordingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	var body []byte
+	if r.Body != nil {
+		body, _ = io.ReadAll(r.Body)
+	}
+	rt.mu.Lock()
+	rt.requests = append(rt.requests, discordRequest{r.Method, r.URL.Path, string(body)})
+	rt.mu.Unlock()
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader("{}")),
+		Request:    r,
+	}, nil
+}
+
+//testSession returns a session which records what it sends instead of
+//sending it
+func testSession(t *testing.T) (*discordgo.Session, *recordingTransport) {
+	s, err := discordgo.New("Bot token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := &recordingTransport{}
+	s.Client = &http.Client{Transport: transport}
+
+	return s, transport
+}
+
+//testInteraction returns an interaction of type typ for the handler name
+func testInteraction(typ discordgo.InteractionType, name string) *discordgo.InteractionCreate {
+	i := &discordgo.Interaction{ID: "interaction", AppID: "app", Token: "token", Type: typ}
+	switch typ {
+	case discordgo.InteractionApplicationCommand, discordgo.InteractionApplicationCommandAutocomplete:
+		i.Data = discordgo.ApplicationCommandInteractionData{Name: name}
+	case discordgo.InteractionMessageComponent:
+		i.Data = discordgo.MessageComponentInteractionData{CustomID: name}
+	case discordgo.InteractionModalSubmit:
+		i.Data = discordgo.ModalSubmitInteractionData{CustomID: name}
+	}
+
+	return &discordgo.InteractionCreate{Interaction: i}
+}
+
+func TestRoute(t *testing.T) {
+	const (
+		callback = "/api/v9/interactions/interaction/token/callback"
+		original = "/api/v9/webhooks/app/token/messages/@original"
+		followup = "/api/v9/webhooks/app/token"
+	)
+
+	//ok answers the interaction before doing anything else
+	ok := func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		respond(s, i, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{Content: "ok"},
+		})
+	}
+	panics := func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		panic("boom")
+	}
+	answerThenPanic := func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		ok(s, i)
+		panics(s, i)
+	}
+	handlers := map[string]handlerFunc{
+		"ok": ok, "panics": panics, "answer_then_panic": answerThenPanic,
+	}
+	cs := commandSet{
+		handlers: handlers, autocompletes: handlers, components: handlers, modals: handlers,
+	}
+
+	tests := []struct {
+		name string
+		typ  discordgo.InteractionType
+		//handler is the name the interaction is for
+		handler string
+		want    []discordRequest
+	}{
+		{
+			name: "unknown type is ignored",
+			typ:  discordgo.InteractionPing, handler: "ok",
+		},
+		{
+			name: "handled",
+			typ:  discordgo.InteractionApplicationCommand, handler: "ok",
+			want: []discordRequest{{"POST", callback, `"content":"ok"`}},
+		},
+		{
+			name: "unknown handler",
+			typ:  discordgo.InteractionApplicationCommand, handler: "missing",
+			want: []discordRequest{{"POST", callback, "I don't know how to do missing"}},
+		},
+		{
+			name: "panic before answering is the first response",
+			typ:  discordgo.InteractionApplicationCommand, handler: "panics",
+			want: []discordRequest{{"POST", callback, "something went wrong"}},
+		},
+		{
+			name: "panic after answering edits the command's response",
+			typ:  discordgo.InteractionApplicationCommand, handler: "answer_then_panic",
+			want: []discordRequest{
+				{"POST", callback, `"content":"ok"`},
+				{"PATCH", original, "something went wrong"},
+			},
+		},
+		{
+			name: "panic after answering a component follows up",
+			typ:  discordgo.InteractionMessageComponent, handler: "answer_then_panic",
+			want: []discordRequest{
+				{"POST", callback, `"content":"ok"`},
+				{"POST", followup, "something went wrong"},
+			},
+		},
+		{
+			name: "panic in a modal is the first response",
+			typ:  discordgo.InteractionModalSubmit, handler: "panics",
+			want: []discordRequest{{"POST", callback, "something went wrong"}},
+		},
+		{
+			//Autocomplete can only be answered with choices, there are none
+			name: "panic in autocomplete sends no choices",
+			typ:  discordgo.InteractionApplicationCommandAutocomplete, handler: "panics",
+			want: []discordRequest{{"POST", callback, `"type":8`}},
+		},
+	}
+
+	for _, test := range tests {
+		s, transport := testSession(t)
+		i := testInteraction(test.typ, test.handler)
+		cs.route(s, i)
+
+		if len(transport.requests) != len(test.want) {
+			t.Errorf("%s: sent %+v want %+v", test.name, transport.requests, test.want)
+			continue
+		}
+		for idx, want := range test.want {
+			got := transport.requests[idx]
+			if got.method != want.method || got.path != want.path || !strings.Contains(got.body, want.body) {
+				t.Errorf("%s: request %d was %+v want %+v", test.name, idx, got, want)
+			}
+		}
+		if _, ok := responded.Load(i.ID); ok {
+			t.Errorf("%s: still remembered as responded to after routing", test.name)
+		}
+	}
+}
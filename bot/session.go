@@ -0,0 +1,406 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	reconnectBaseDelay   = time.Second
+	reconnectMaxDelay    = 2 * time.Minute
+	maxReconnectAttempts = 10
+)
+
+var (
+	//errVoiceLost is returned by play funcs when the voice connection drops
+	errVoiceLost = errors.New("lost voice connection")
+	//errShuttingDown is returned by start once shutdown has been called
+	errShuttingDown = errors.New("shutting down")
+)
+
+//sessionState is where a guild's session is up to
+type sessionState int
+
+const (
+	stateIdle sessionState = iota
+	stateConnecting
+	statePlaying
+	stateStopping
+)
+
+func (s sessionState) String() string {
+	switch s {
+	case stateConnecting:
+		return "connecting"
+	case statePlaying:
+		return "playing"
+	case stateStopping:
+		return "stopping"
+	}
+
+	return "idle"
+}
+
+//playFunc plays into the voice connection until ctx is done or it gives up,
+//returning errVoiceLost has the session reconnect and call it again. restart
+//receives when the current track should be played again with new settings.
+type playFunc func(
+	ctx context.Context, v *discordgo.VoiceConnection, restart <-chan struct{},
+) error
+
+//voiceJoiner joins voice channels, it's a *discordgo.Session outside of
+//tests
+type voiceJoiner interface {
+	ChannelVoiceJoin(guildID, channelID string, mute, deaf bool) (*discordgo.VoiceConnection, error)
+}
+
+//session is a guild's voice connection and whatever is playing into it, the
+//session is the only thing which joins or leaves voice for the guild
+type session struct {
+	guildID string
+	cancel  context.CancelFunc
+	//done is closed once the session has left voice
+	done    chan struct{}
+	restart chan struct{}
+
+	mu        sync.Mutex
+	state     sessionState
+	channelID string
+	//joining is set while joining voice, leaving the old channel is part of
+	//that
+	joining bool
+	//playing is the track being played, nil until the first one starts
+	playing *nowPlaying
+}
+
+func (s *session) getState() sessionState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.state
+}
+
+func (s *session) setState(state sessionState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.state = state
+}
+
+func (s *session) channel() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.channelID
+}
+
+//kicked reports if the bot being disconnected from voice means someone
+//removed it, rather than the session leaving or switching channels itself
+func (s *session) kicked() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return (s.state == statePlaying || s.state == stateConnecting) && !s.joining
+}
+
+//join joins the session's channel
+func (s *session) join(dg voiceJoiner) (*discordgo.VoiceConnection, error) {
+	s.mu.Lock()
+	s.joining = true
+	channelID := s.channelID
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.joining = false
+		s.mu.Unlock()
+	}()
+
+	return dg.ChannelVoiceJoin(s.guildID, channelID, false, true)
+}
+
+//stop cancels the session and waits for it to leave voice
+func (s *session) stop() {
+	s.mu.Lock()
+	if s.state == statePlaying || s.state == stateConnecting {
+		s.state = stateStopping
+	}
+	s.mu.Unlock()
+
+	s.cancel()
+	<-s.done
+}
+
+//sessionManager tracks the session for every guild
+type sessionManager struct {
+	mu       sync.Mutex
+	sessions map[string]*session
+	//onEnd is called once a guild's session has finished for good, it's not
+	//called for sessions stopped by shutdown so they can be resumed
+	onEnd   func(guildID string)
+	closing bool
+}
+
+func newSessionManager(onEnd func(guildID string)) *sessionManager {
+	return &sessionManager{sessions: make(map[string]*session), onEnd: onEnd}
+}
+
+//get returns the guild's session or nil if it's idle
+func (m *sessionManager) get(guildID string) *session {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.sessions[guildID]
+}
+
+//state returns what the guild's session is doing
+func (m *sessionManager) state(guildID string) sessionState {
+	if s := m.get(guildID); s != nil {
+		return s.getState()
+	}
+
+	return stateIdle
+}
+
+//start stops anything the guild is playing then joins the channel and runs
+//play in the background until it returns or the session is stopped
+func (m *sessionManager) start(
+	ctx context.Context, dg voiceJoiner, guildID, channelID string, play playFunc,
+) error {
+	ctx, cancel := context.WithCancel(ctx)
+	sess := &session{
+		guildID:   guildID,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+		restart:   make(chan struct{}, 1),
+		state:     stateConnecting,
+		channelID: channelID,
+	}
+
+	//Keep stopping until this is the guild's only session in case another
+	//start snuck in while waiting
+	for {
+		m.mu.Lock()
+		if m.closing {
+			m.mu.Unlock()
+			cancel()
+			return errShuttingDown
+		}
+		existing := m.sessions[guildID]
+		if existing == nil {
+			m.sessions[guildID] = sess
+			m.mu.Unlock()
+			break
+		}
+		m.mu.Unlock()
+
+		log.Printf("%s stopping existing session to start a new one\n", guildID)
+		existing.stop()
+	}
+
+	voice, err := sess.join(dg)
+	if err != nil {
+		cancel()
+		m.remove(sess)
+		close(sess.done)
+		return err
+	}
+
+	sess.mu.Lock()
+	if sess.state == stateConnecting {
+		sess.state = statePlaying
+	}
+	sess.mu.Unlock()
+
+	go func() {
+		defer close(sess.done)
+		defer m.remove(sess)
+		defer cancel()
+
+		for {
+			err := play(ctx, voice, sess.restart)
+			if !errors.Is(err, errVoiceLost) || ctx.Err() != nil {
+				break
+			}
+
+			log.Printf("%s %v reconnecting\n", guildID, err)
+			next, err := m.reconnect(ctx, dg, sess)
+			if err != nil {
+				log.Printf("%s giving up on voice: %v\n", guildID, err)
+				break
+			}
+			voice = next
+		}
+
+		sess.setState(stateStopping)
+		if err := voice.Disconnect(); err != nil {
+			log.Printf("%s unable to leave voice: %v\n", guildID, err)
+		}
+		if m.onEnd != nil && !m.isClosing() {
+			m.onEnd(guildID)
+		}
+	}()
+
+	return nil
+}
+
+//reconnect joins the session's channel again backing off between attempts
+func (m *sessionManager) reconnect(
+	ctx context.Context, dg voiceJoiner, sess *session,
+) (*discordgo.VoiceConnection, error) {
+	sess.mu.Lock()
+	if sess.state == statePlaying {
+		sess.state = stateConnecting
+	}
+	sess.mu.Unlock()
+
+	delay := reconnectBaseDelay
+	var err error
+	for attempt := 1; attempt <= maxReconnectAttempts; attempt++ {
+		select {
+		case <-botClock.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		delay *= 2
+		if delay > reconnectMaxDelay {
+			delay = reconnectMaxDelay
+		}
+
+		var voice *discordgo.VoiceConnection
+		voice, err = sess.join(dg)
+		if err == nil {
+			sess.mu.Lock()
+			if sess.state == stateConnecting {
+				sess.state = statePlaying
+			}
+			sess.mu.Unlock()
+			log.Printf("%s reconnected to voice after %d attempts\n", sess.guildID, attempt)
+			return voice, nil
+		}
+		log.Printf("%s reconnect attempt %d failed: %v\n", sess.guildID, attempt, err)
+	}
+
+	return nil, err
+}
+
+//stop stops the guild's session returning false if there wasn't one
+func (m *sessionManager) stop(guildID string) bool {
+	s := m.get(guildID)
+	if s == nil {
+		return false
+	}
+
+	s.stop()
+	return true
+}
+
+//restartTrack has the guild's session play its current track again to pick
+//up new settings, returning false if nothing is playing
+func (m *sessionManager) restartTrack(guildID string) bool {
+	s := m.get(guildID)
+	if s == nil {
+		return false
+	}
+
+	select {
+	case s.restart <- struct{}{}:
+	default:
+		//Already going to restart
+	}
+	return true
+}
+
+//setPlaying records the track the guild's session has started playing
+func (m *sessionManager) setPlaying(guildID string, playing nowPlaying) {
+	if s := m.get(guildID); s != nil {
+		s.mu.Lock()
+		s.playing = &playing
+		s.mu.Unlock()
+	}
+}
+
+//playing returns the track the guild's session is playing, false if nothing
+//has started yet
+func (m *sessionManager) playing(guildID string) (nowPlaying, bool) {
+	s := m.get(guildID)
+	if s == nil {
+		return nowPlaying{}, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.playing == nil {
+		return nowPlaying{}, false
+	}
+	return *s.playing, true
+}
+
+//isClosing is true once shutdown has been called
+func (m *sessionManager) isClosing() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.closing
+}
+
+//shutdown stops every session and refuses new ones, it returns once they've
+//all left voice or ctx is done
+func (m *sessionManager) shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	m.closing = true
+	running := make([]*session, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		running = append(running, s)
+	}
+	m.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, s := range running {
+		wg.Add(1)
+		go func(s *session) {
+			defer wg.Done()
+			s.stop()
+		}(s)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+//moved records the bot being moved to another channel, being disconnected
+//isn't a move
+func (m *sessionManager) moved(guildID, channelID string) {
+	if channelID == "" {
+		return
+	}
+	if s := m.get(guildID); s != nil {
+		s.mu.Lock()
+		s.channelID = channelID
+		s.mu.Unlock()
+	}
+}
+
+//remove forgets the session if it's still the guild's current one
+func (m *sessionManager) remove(s *session) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.sessions[s.guildID] == s {
+		delete(m.sessions, s.guildID)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/sardap/vibes/bot/clock"
+)
+
+//testJoiner hands each join attempt to the test which answers on results
+type testJoiner struct {
+	attempts chan time.Time
+	results  chan error
+	clock    clock.Clock
+}
+
+func newTestJoiner(clk clock.Clock) *testJoiner {
+	return &testJoiner{attempts: make(chan time.Time), results: make(chan error), clock: clk}
+}
+
+func (j *testJoiner) ChannelVoiceJoin(
+	guildID, channelID string, mute, deaf bool,
+) (*discordgo.VoiceConnection, error) {
+	j.attempts <- j.clock.Now()
+	if err := <-j.results; err != nil {
+		return nil, err
+	}
+
+	return &discordgo.VoiceConnection{GuildID: guildID, ChannelID: channelID}, nil
+}
+
+//useFakeClock swaps botClock for a fake one for the rest of the test
+func useFakeClock(t *testing.T) *clock.Fake {
+	fake := clock.NewFake(time.Date(2021, 1, 2, 13, 0, 0, 0, time.UTC))
+	previous := botClock
+	botClock = fake
+	t.Cleanup(func() { botClock = previous })
+
+	return fake
+}
+
+type reconnectResult struct {
+	voice *discordgo.VoiceConnection
+	err   error
+}
+
+func TestReconnectBackoff(t *testing.T) {
+	tests := []struct {
+		name string
+		//failures is how many attempts fail before one works
+		failures int
+		wantErr  bool
+	}{
+		{"first attempt", 0, false},
+		{"after a few", 3, false},
+		{"hits the cap", 8, false},
+		{"gives up", maxReconnectAttempts, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := useFakeClock(t)
+			joiner := newTestJoiner(fake)
+			sess := &session{guildID: "guild", channelID: "channel", state: statePlaying}
+			m := newSessionManager(nil)
+
+			done := make(chan reconnectResult, 1)
+			go func() {
+				voice, err := m.reconnect(context.Background(), joiner, sess)
+				done <- reconnectResult{voice, err}
+			}()
+
+			want := reconnectBaseDelay
+			for attempt := 0; attempt < maxReconnectAttempts && attempt <= test.failures; attempt++ {
+				fake.BlockUntil(1)
+				if attempt == 0 && sess.getState() != stateConnecting {
+					t.Errorf("state is %s while reconnecting", sess.getState())
+				}
+
+				//Nothing happens until the backoff is over
+				before := fake.Now()
+				fake.Advance(want - time.Millisecond)
+				select {
+				case <-joiner.attempts:
+					t.Fatalf("attempt %d came before %s", attempt+1, want)
+				default:
+				}
+				fake.Advance(time.Millisecond)
+				if at := <-joiner.attempts; at.Sub(before) != want {
+					t.Fatalf("attempt %d came after %s want %s", attempt+1, at.Sub(before), want)
+				}
+
+				if attempt < test.failures {
+					joiner.results <- fmt.Errorf("attempt %d failed", attempt+1)
+				} else {
+					joiner.results <- nil
+				}
+
+				want *= 2
+				if want > reconnectMaxDelay {
+					want = reconnectMaxDelay
+				}
+			}
+
+			result := <-done
+			if test.wantErr {
+				if result.err == nil {
+					t.Fatalf("reconnect didn't give up")
+				}
+				if sess.getState() != stateConnecting {
+					t.Errorf("state is %s after giving up", sess.getState())
+				}
+				return
+			}
+			if result.err != nil || result.voice == nil {
+				t.Fatalf("reconnect gave %v %v", result.voice, result.err)
+			}
+			if sess.getState() != statePlaying {
+				t.Errorf("state is %s after reconnecting", sess.getState())
+			}
+		})
+	}
+}
+
+func TestReconnectCancel(t *testing.T) {
+	fake := useFakeClock(t)
+	joiner := newTestJoiner(fake)
+	sess := &session{guildID: "guild", channelID: "channel", state: statePlaying}
+	m := newSessionManager(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan reconnectResult, 1)
+	go func() {
+		voice, err := m.reconnect(ctx, joiner, sess)
+		done <- reconnectResult{voice, err}
+	}()
+
+	fake.BlockUntil(1)
+	cancel()
+	if result := <-done; !errors.Is(result.err, context.Canceled) {
+		t.Errorf("cancelled reconnect gave %v", result.err)
+	}
+}
+
+func TestSessionKicked(t *testing.T) {
+	tests := []struct {
+		state   sessionState
+		joining bool
+		want    bool
+	}{
+		{stateIdle, false, false},
+		{stateConnecting, false, true},
+		{statePlaying, false, true},
+		{statePlaying, true, false},
+		{stateConnecting, true, false},
+		{stateStopping, false, false},
+	}
+
+	for _, test := range tests {
+		sess := &session{state: test.state, joining: test.joining}
+		if got := sess.kicked(); got != test.want {
+			t.Errorf(
+				"%s joining %v kicked() = %v want %v", test.state, test.joining, got, test.want,
+			)
+		}
+	}
+}
+
+func TestSessionMoved(t *testing.T) {
+	m := newSessionManager(nil)
+	m.sessions["guild"] = &session{guildID: "guild", channelID: "first", state: statePlaying}
+
+	m.moved("guild", "second")
+	if got := m.get("guild").channel(); got != "second" {
+		t.Errorf("channel is %s after moving", got)
+	}
+	//Being disconnected isn't a move
+	m.moved("guild", "")
+	if got := m.get("guild").channel(); got != "second" {
+		t.Errorf("channel is %q after being disconnected", got)
+	}
+	//Nothing happens for guilds without a session
+	m.moved("other", "third")
+	if m.get("other") != nil {
+		t.Errorf("moving an idle guild made a session")
+	}
+}
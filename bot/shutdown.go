@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+//shutdownTimeout is how long sessions get to leave voice before giving up
+const shutdownTimeout = 15 * time.Second
+
+//shuttingDown is set once commands should be turned away
+var shuttingDown atomic.Bool
+
+//refuseCommand tells the user the bot is going away
+func refuseCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	respond(s, i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: "I'm restarting, try again in a minute",
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+}
+
+//shutdown leaves every voice channel and closes everything down. Sessions
+//are left in the store so they're resumed on the next start.
+func shutdown(s *discordgo.Session) {
+	shuttingDown.Store(true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := sessions.shutdown(ctx); err != nil {
+		log.Printf("Not every session stopped in time: %v\n", err)
+	}
+
+	//Anything still encoding is only for prefetching
+	frames.close()
+
+	if err := guildStore.Close(); err != nil {
+		log.Printf("Unable to close store: %v\n", err)
+	}
+	if err := s.Close(); err != nil {
+		log.Printf("Unable to close discord session: %v\n", err)
+	}
+}
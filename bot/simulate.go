@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sardap/vibes/bot/clock"
+	"github.com/sardap/vibes/bot/sink"
+	"github.com/sardap/vibes/bot/store"
+	"github.com/sardap/vibes/bot/vibes"
+)
+
+//simulateStep is how far the fake clock moves each time the player waits,
+//one opus frame
+const simulateStep = 20 * time.Millisecond
+
+type fileSink interface {
+	sink.AudioSink
+	io.Closer
+}
+
+//simulate plays a guild's vibes into a file using a fake clock so an hour
+//takes as long as fetching and encoding does, run with main simulate -h
+func simulate(args []string) error {
+	flags := flag.NewFlagSet("simulate", flag.ExitOnError)
+	backend := flags.String("backend", "", "backend from the config to play")
+	country := flags.String("country", "US", "two letter country code")
+	city := flags.String("city", "new york", "city for the weather")
+	timezone := flags.String("timezone", "America/New_York", "timezone or offset like -0500")
+	start := flags.String("start", "", "local time to start at like 2021-01-02T13:55:00, default now")
+	duration := flags.Duration("duration", time.Hour, "how long to play for")
+	wacky := flags.Bool("wacky", false, "turn on wacky")
+	out := flags.String("out", "simulated.ogg", "file to write, .ogg or .wav")
+	flags.Parse(args)
+
+	configureEncoder()
+	//Prefetching would wait on the fake clock too and confuse the driver
+	prefetchLead = 0
+
+	loader := &backendLoader{
+		path:    os.Getenv("VIBES_CONFIG"),
+		client:  &http.Client{},
+		timeout: vibes.DefaultTimeout,
+	}
+	if err := loader.load(); err != nil {
+		return err
+	}
+	v, ok := currentBackends.Load().sets[*backend]
+	if !ok {
+		return fmt.Errorf("unknown backend %q", *backend)
+	}
+
+	info := &guildInfo{store.NewGuild()}
+	info.Country, info.City = strings.ToUpper(*country), *city
+	var err error
+	info.Timezone, info.Offset, err = parseTimezone(*timezone)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().In(info.location())
+	if *start != "" {
+		now, err = time.ParseInLocation("2006-01-02T15:04:05", *start, info.location())
+		if err != nil {
+			return fmt.Errorf("invalid start: %w", err)
+		}
+	}
+
+	sets, err := v.invoker.GetSetsContext(context.Background())
+	if err != nil {
+		return fmt.Errorf("getting sets: %w", err)
+	}
+	if len(sets) == 0 {
+		return fmt.Errorf("the backend doesn't have any music sets")
+	}
+
+	var file fileSink
+	switch strings.ToLower(filepath.Ext(*out)) {
+	case ".wav":
+		file, err = sink.NewWAVFile(*out, defaultOptions.Channels)
+	default:
+		file, err = sink.NewOggFile(*out, defaultOptions.Channels)
+	}
+	if err != nil {
+		return err
+	}
+
+	fake := clock.NewFake(now)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- info.startVibing(
+			ctx, v.invoker, sets, "simulate", sink.Paced(file, fake), *wacky, nil, nil, fake,
+		)
+	}()
+
+	//Move time along whenever the player is waiting for it
+	end := now.Add(*duration)
+	for err == nil && fake.Now().Before(end) {
+		waiting := make(chan struct{})
+		go func() {
+			fake.BlockUntil(1)
+			close(waiting)
+		}()
+
+		select {
+		case <-waiting:
+			fake.Advance(simulateStep)
+		case err = <-done:
+		}
+	}
+
+	cancel()
+	if err == nil {
+		<-done
+	}
+	log.Printf("Simulated %s to %s\n", fake.Now().Sub(now), *out)
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,54 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+//sendTimeout is how long discord gets to take a frame before the
+//connection is assumed dead, the same as dca uses
+const sendTimeout = time.Second
+
+//Discord plays frames into a voice connection
+type Discord struct {
+	voice *discordgo.VoiceConnection
+}
+
+//NewDiscord returns a sink for the voice connection
+func NewDiscord(voice *discordgo.VoiceConnection) *Discord {
+	return &Discord{voice: voice}
+}
+
+//Speaking sets the bot's speaking indicator
+func (d *Discord) Speaking(speaking bool) error {
+	if speaking && !d.ready() {
+		return ErrDisconnected
+	}
+
+	return d.voice.Speaking(speaking)
+}
+
+func (d *Discord) ready() bool {
+	d.voice.RLock()
+	defer d.voice.RUnlock()
+
+	return d.voice.Ready
+}
+
+//WriteFrame sends the frame to discord which takes them in real time
+func (d *Discord) WriteFrame(ctx context.Context, frame []byte, _ time.Duration) error {
+	timeout := time.NewTimer(sendTimeout)
+	defer timeout.Stop()
+
+	select {
+	case d.voice.OpusSend <- frame:
+		return nil
+	case <-timeout.C:
+		return fmt.Errorf("%w: voice connection stopped taking frames", ErrDisconnected)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
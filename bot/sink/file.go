@@ -0,0 +1,220 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+)
+
+const (
+	//opusRate is the rate granule positions are counted in no matter what
+	//rate the audio was encoded at
+	opusRate = 48000
+	//opusPreSkip is the usual encoder delay at 48kHz
+	opusPreSkip = 312
+	//oggSerial identifies the stream, there's only ever one per file
+	oggSerial = 1
+
+	oggBOS = 0x02
+	oggEOS = 0x04
+)
+
+//oggCRC is the lookup table for ogg's CRC-32, polynomial 0x04c11db7 without
+//reflection so hash/crc32 can't be used
+var oggCRC = func() (table [256]uint32) {
+	for i := range table {
+		crc := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}()
+
+//oggChecksum is the CRC of a page with its CRC field zeroed
+func oggChecksum(b []byte) uint32 {
+	var crc uint32
+	for _, c := range b {
+		crc = crc<<8 ^ oggCRC[byte(crc>>24)^c]
+	}
+
+	return crc
+}
+
+//oggWriter writes each packet on its own page
+type oggWriter struct {
+	w        io.Writer
+	sequence uint32
+}
+
+func (o *oggWriter) writePage(flags byte, granule int64, packet []byte) error {
+	if len(packet) > 255*255-1 {
+		return fmt.Errorf("packet of %d bytes too big for one page", len(packet))
+	}
+
+	//Lacing values are 255 until the last which is less, so a packet which
+	//is a multiple of 255 ends with a 0
+	segments := make([]byte, 0, len(packet)/255+1)
+	for n := len(packet); ; n -= 255 {
+		if n < 255 {
+			segments = append(segments, byte(n))
+			break
+		}
+		segments = append(segments, 255)
+	}
+
+	var page bytes.Buffer
+	page.WriteString("OggS")
+	binary.Write(&page, binary.LittleEndian, struct {
+		Version  uint8
+		Flags    uint8
+		Granule  int64
+		Serial   uint32
+		Sequence uint32
+		CRC      uint32
+		Segments uint8
+	}{0, flags, granule, oggSerial, o.sequence, 0, uint8(len(segments))})
+	page.Write(segments)
+	page.Write(packet)
+
+	b := page.Bytes()
+	binary.LittleEndian.PutUint32(b[22:], oggChecksum(b))
+
+	o.sequence++
+	_, err := o.w.Write(b)
+	return err
+}
+
+//Ogg writes frames into an Ogg Opus stream
+type Ogg struct {
+	closer  io.Closer
+	ogg     *oggWriter
+	granule int64
+}
+
+//NewOgg writes an Ogg Opus stream of audio with the number of channels to
+//w, Close must be called to finish it
+func NewOgg(w io.Writer, channels int) (*Ogg, error) {
+	result := &Ogg{ogg: &oggWriter{w: w}}
+
+	var head bytes.Buffer
+	head.WriteString("OpusHead")
+	binary.Write(&head, binary.LittleEndian, struct {
+		Version    uint8
+		Channels   uint8
+		PreSkip    uint16
+		SampleRate uint32
+		Gain       int16
+		Mapping    uint8
+	}{1, uint8(channels), opusPreSkip, opusRate, 0, 0})
+	if err := result.ogg.writePage(oggBOS, 0, head.Bytes()); err != nil {
+		return nil, err
+	}
+
+	vendor := "vibes"
+	var tags bytes.Buffer
+	tags.WriteString("OpusTags")
+	binary.Write(&tags, binary.LittleEndian, uint32(len(vendor)))
+	tags.WriteString(vendor)
+	binary.Write(&tags, binary.LittleEndian, uint32(0))
+	if err := result.ogg.writePage(0, 0, tags.Bytes()); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+//NewOggFile creates an Ogg Opus file at path
+func NewOggFile(path string, channels int) (*Ogg, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := NewOgg(f, channels)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	result.closer = f
+
+	return result, nil
+}
+
+//Speaking does nothing, gaps between samples aren't written
+func (o *Ogg) Speaking(bool) error {
+	return nil
+}
+
+//WriteFrame appends the frame to the stream
+func (o *Ogg) WriteFrame(ctx context.Context, frame []byte, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	o.granule += int64(d) * opusRate / int64(time.Second)
+	return o.ogg.writePage(0, o.granule, frame)
+}
+
+//Close ends the stream and closes the file if there is one
+func (o *Ogg) Close() error {
+	err := o.ogg.writePage(oggEOS, o.granule, nil)
+	if o.closer != nil {
+		if closeErr := o.closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
+
+//WAV decodes frames into a wav file, ffmpeg does the decoding
+type WAV struct {
+	*Ogg
+	cmd *exec.Cmd
+}
+
+//NewWAVFile creates a wav file at path using ffmpeg to decode the frames
+func NewWAVFile(path string, channels int) (*WAV, error) {
+	cmd := exec.Command(
+		"ffmpeg", "-loglevel", "error", "-y", "-f", "ogg", "-i", "pipe:0", "-f", "wav", path,
+	)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("starting ffmpeg: %w", err)
+	}
+
+	stream, err := NewOgg(stdin, channels)
+	if err != nil {
+		stdin.Close()
+		cmd.Wait()
+		return nil, err
+	}
+	stream.closer = stdin
+
+	return &WAV{Ogg: stream, cmd: cmd}, nil
+}
+
+//Close finishes the stream and waits for ffmpeg to write the file
+func (w *WAV) Close() error {
+	err := w.Ogg.Close()
+	if waitErr := w.cmd.Wait(); err == nil && waitErr != nil {
+		err = fmt.Errorf("ffmpeg: %w", waitErr)
+	}
+
+	return err
+}
@@ -0,0 +1,147 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestOggChecksum(t *testing.T) {
+	tests := []struct {
+		data string
+		want uint32
+	}{
+		{"", 0},
+		//CRC-32/POSIX's check value without its final xor
+		{"123456789", 0x89a1897f},
+		{"OggS", 0x5fb0a94f},
+	}
+
+	for _, test := range tests {
+		if got := oggChecksum([]byte(test.data)); got != test.want {
+			t.Errorf("oggChecksum(%q) = %#08x want %#08x", test.data, got, test.want)
+		}
+	}
+}
+
+type oggPage struct {
+	flags    byte
+	granule  int64
+	sequence uint32
+	packet   []byte
+}
+
+//readPages parses an ogg stream checking every page's CRC
+func readPages(t *testing.T, r io.Reader) []oggPage {
+	t.Helper()
+
+	result := make([]oggPage, 0)
+	for {
+		header := make([]byte, 27)
+		if _, err := io.ReadFull(r, header); err == io.EOF {
+			return result
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if string(header[:4]) != "OggS" {
+			t.Fatalf("page %d starts with %q", len(result), header[:4])
+		}
+
+		segments := make([]byte, header[26])
+		if _, err := io.ReadFull(r, segments); err != nil {
+			t.Fatal(err)
+		}
+		size := 0
+		for _, s := range segments {
+			size += int(s)
+		}
+		packet := make([]byte, size)
+		if _, err := io.ReadFull(r, packet); err != nil {
+			t.Fatal(err)
+		}
+
+		page := append(append(append([]byte{}, header...), segments...), packet...)
+		crc := binary.LittleEndian.Uint32(page[22:])
+		binary.LittleEndian.PutUint32(page[22:], 0)
+		if want := oggChecksum(page); crc != want {
+			t.Errorf("page %d has CRC %#08x want %#08x", len(result), crc, want)
+		}
+
+		result = append(result, oggPage{
+			flags:    header[5],
+			granule:  int64(binary.LittleEndian.Uint64(header[6:])),
+			sequence: binary.LittleEndian.Uint32(header[18:]),
+			packet:   packet,
+		})
+	}
+}
+
+func TestOgg(t *testing.T) {
+	var buf bytes.Buffer
+	o, err := NewOgg(&buf, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//Sizes around the lacing value boundaries
+	frames := [][]byte{
+		bytes.Repeat([]byte{1}, 10),
+		bytes.Repeat([]byte{2}, 255),
+		bytes.Repeat([]byte{3}, 510),
+		bytes.Repeat([]byte{4}, 1000),
+	}
+	for _, frame := range frames {
+		if err := o.WriteFrame(context.Background(), frame, 20*time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := o.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	pages := readPages(t, &buf)
+	if len(pages) != len(frames)+3 {
+		t.Fatalf("got %d pages want %d", len(pages), len(frames)+3)
+	}
+	for i, page := range pages {
+		if page.sequence != uint32(i) {
+			t.Errorf("page %d has sequence %d", i, page.sequence)
+		}
+	}
+
+	if pages[0].flags != oggBOS || !bytes.HasPrefix(pages[0].packet, []byte("OpusHead")) {
+		t.Errorf("first page isn't the opus head: %+v", pages[0])
+	}
+	if channels := pages[0].packet[9]; channels != 2 {
+		t.Errorf("head has %d channels want 2", channels)
+	}
+	if !bytes.HasPrefix(pages[1].packet, []byte("OpusTags")) {
+		t.Errorf("second page isn't the opus tags")
+	}
+	for i, frame := range frames {
+		page := pages[i+2]
+		if !bytes.Equal(page.packet, frame) {
+			t.Errorf("frame %d came back as %d bytes", i, len(page.packet))
+		}
+		//20ms at 48kHz
+		if want := int64(960 * (i + 1)); page.granule != want {
+			t.Errorf("frame %d has granule %d want %d", i, page.granule, want)
+		}
+	}
+	if last := pages[len(pages)-1]; last.flags != oggEOS || len(last.packet) != 0 {
+		t.Errorf("last page isn't an empty end of stream: %+v", last)
+	}
+}
+
+func TestOggTooBig(t *testing.T) {
+	o, err := NewOgg(io.Discard, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := o.WriteFrame(context.Background(), make([]byte, 255*255), time.Millisecond); err == nil {
+		t.Errorf("writing a frame too big for a page didn't fail")
+	}
+}
@@ -0,0 +1,63 @@
+//Package sink is where the scheduler sends the opus frames it plays, the
+//same scheduling code can play into discord, a file or nowhere at all
+package sink
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/sardap/vibes/bot/clock"
+)
+
+//ErrDisconnected is returned when the sink can't take frames anymore
+var ErrDisconnected = errors.New("sink disconnected")
+
+//AudioSink takes opus frames as they're played
+type AudioSink interface {
+	//Speaking is called with true before each sample and false after
+	Speaking(speaking bool) error
+	//WriteFrame blocks until the frame has been taken, d is how long it
+	//plays for
+	WriteFrame(ctx context.Context, frame []byte, d time.Duration) error
+}
+
+//Null throws frames away
+type Null struct{}
+
+//Speaking does nothing
+func (Null) Speaking(bool) error {
+	return nil
+}
+
+//WriteFrame does nothing
+func (Null) WriteFrame(ctx context.Context, frame []byte, d time.Duration) error {
+	return ctx.Err()
+}
+
+//paced is a sink which waits for each frame to play
+type paced struct {
+	AudioSink
+	clock clock.Clock
+}
+
+//Paced waits on clk for each frame to finish after writing it to s. Sinks
+//other than discord take frames as fast as they're given so wrap them with
+//this when the scheduler needs time to pass, with a fake clock a whole hour
+//can be played by advancing it.
+func Paced(s AudioSink, clk clock.Clock) AudioSink {
+	return &paced{AudioSink: s, clock: clk}
+}
+
+func (p *paced) WriteFrame(ctx context.Context, frame []byte, d time.Duration) error {
+	if err := p.AudioSink.WriteFrame(ctx, frame, d); err != nil {
+		return err
+	}
+
+	select {
+	case <-p.clock.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,42 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sardap/vibes/bot/clock"
+)
+
+func TestPaced(t *testing.T) {
+	fake := clock.NewFake(time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC))
+	s := Paced(Null{}, fake)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.WriteFrame(context.Background(), []byte{1}, 20*time.Millisecond)
+	}()
+
+	fake.BlockUntil(1)
+	fake.Advance(19 * time.Millisecond)
+	select {
+	case err := <-done:
+		t.Fatalf("frame finished early with %v", err)
+	default:
+	}
+	fake.Advance(time.Millisecond)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		done <- s.WriteFrame(ctx, []byte{1}, time.Second)
+	}()
+	fake.BlockUntil(1)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled write returned %v", err)
+	}
+}
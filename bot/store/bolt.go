@@ -0,0 +1,180 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	guildsBucket   = []byte("guilds")
+	sessionsBucket = []byte("sessions")
+)
+
+//Bolt is a GuildStore keeping JSON records in a bbolt file
+type Bolt struct {
+	db *bolt.DB
+}
+
+//OpenBolt opens or creates the file at path upgrading any old records
+func OpenBolt(path string) (*Bolt, error) {
+	db, err := bolt.Open(path, 0666, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(guildsBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(sessionsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	result := &Bolt{db: db}
+	if err := result.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrating guilds: %w", err)
+	}
+
+	return result, nil
+}
+
+//migrate upgrades every guild record, records from a newer version are left
+//alone
+func (b *Bolt) migrate() error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(guildsBucket)
+
+		upgraded := make(map[string][]byte)
+		err := bucket.ForEach(func(k, v []byte) error {
+			var g Guild
+			if err := json.Unmarshal(v, &g); err != nil {
+				log.Printf("%s bad guild record skipping migration: %v\n", k, err)
+				return nil
+			}
+			if g.Version > GuildVersion {
+				log.Printf(
+					"%s guild record is version %d but I only know %d\n",
+					k, g.Version, GuildVersion,
+				)
+				return nil
+			}
+			if !g.Migrate() {
+				return nil
+			}
+
+			val, err := json.Marshal(g)
+			if err != nil {
+				return err
+			}
+			upgraded[string(k)] = val
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		//Can't modify a bucket while iterating it
+		for k, v := range upgraded {
+			if err := bucket.Put([]byte(k), v); err != nil {
+				return err
+			}
+		}
+		if len(upgraded) > 0 {
+			log.Printf("Migrated %d guild records to version %d\n", len(upgraded), GuildVersion)
+		}
+
+		return nil
+	})
+}
+
+//Guild returns the guild's record
+func (b *Bolt) Guild(id string) (Guild, error) {
+	var result Guild
+	err := b.db.View(func(tx *bolt.Tx) error {
+		val := tx.Bucket(guildsBucket).Get([]byte(id))
+		if val == nil {
+			return ErrNotFound
+		}
+
+		if err := json.Unmarshal(val, &result); err != nil {
+			return fmt.Errorf("bad guild record %s: %w", id, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return Guild{}, err
+	}
+
+	//Records are migrated on open but a newer bot might have written it
+	result.Migrate()
+	return result, nil
+}
+
+//SetGuild saves the guild's record
+func (b *Bolt) SetGuild(id string, g Guild) error {
+	g.Migrate()
+	val, err := json.Marshal(g)
+	if err != nil {
+		return err
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(guildsBucket).Put([]byte(id), val)
+	})
+}
+
+//Sessions returns every saved session, bad or newer records are skipped
+func (b *Bolt) Sessions() (map[string]Session, error) {
+	result := make(map[string]Session)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(sessionsBucket).ForEach(func(k, v []byte) error {
+			var s Session
+			if err := json.Unmarshal(v, &s); err != nil {
+				log.Printf("%s bad session record skipping: %v\n", k, err)
+				return nil
+			}
+			//Records from before versions are the same as version 1
+			if s.Version > SessionVersion {
+				log.Printf("%s session record is version %d skipping\n", k, s.Version)
+				return nil
+			}
+			result[string(k)] = s
+			return nil
+		})
+	})
+
+	return result, err
+}
+
+//SetSession saves the guild's session
+func (b *Bolt) SetSession(id string, s Session) error {
+	s.Version = SessionVersion
+	val, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(sessionsBucket).Put([]byte(id), val)
+	})
+}
+
+//DeleteSession forgets the guild's session
+func (b *Bolt) DeleteSession(id string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(sessionsBucket).Delete([]byte(id))
+	})
+}
+
+//Close syncs and closes the file
+func (b *Bolt) Close() error {
+	return b.db.Close()
+}
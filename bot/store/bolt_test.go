@@ -0,0 +1,125 @@
+package store
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestBolt(t *testing.T) {
+	s, err := OpenBolt(filepath.Join(t.TempDir(), "vibes.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	testGuildStore(t, s)
+}
+
+func TestBoltMigrate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vibes.db")
+	records := map[string]string{
+		"v0": `{"country":"AU","city":"sydney","offset":"1000"}`,
+		"v1": `{"country":"US","city":"boston","version":1,` +
+			`"preferences":{"default_set":"cafe","volume":40,"bell":false}}`,
+		"future": `{"country":"NZ","city":"auckland","version":99,"preferences":{"volume":5}}`,
+		"bad":    `{"country":`,
+	}
+	sessions := map[string]string{
+		"old":    `{"channel_id":"c","backend":"cafe"}`,
+		"future": `{"version":99,"channel_id":"d","backend":"cafe"}`,
+		"bad":    `[`,
+	}
+
+	db, err := bolt.Open(path, 0666, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		buckets := map[string]map[string]string{"guilds": records, "sessions": sessions}
+		for bucket, values := range buckets {
+			b, err := tx.CreateBucket([]byte(bucket))
+			if err != nil {
+				return err
+			}
+			for k, v := range values {
+				if err := b.Put([]byte(k), []byte(v)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := OpenBolt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//Records are rewritten at the current version on open
+	raw := make(map[string]Guild)
+	err = s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(guildsBucket).ForEach(func(k, v []byte) error {
+			var g Guild
+			if json.Unmarshal(v, &g) == nil {
+				raw[string(k)] = g
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		id      string
+		version int
+		prefs   Preferences
+	}{
+		{"v0", GuildVersion, DefaultPreferences()},
+		{"v1", GuildVersion, Preferences{DefaultSet: "cafe", Volume: 40, BellVolume: DefaultVolume}},
+		{"future", 99, Preferences{Volume: 5}},
+	}
+	for _, test := range tests {
+		g, ok := raw[test.id]
+		if !ok {
+			t.Errorf("%s is missing after migrating", test.id)
+			continue
+		}
+		if g.Version != test.version || g.Preferences != test.prefs {
+			t.Errorf(
+				"%s stored as version %d %+v want %d %+v",
+				test.id, g.Version, g.Preferences, test.version, test.prefs,
+			)
+		}
+	}
+	if g, err := s.Guild("v0"); err != nil || g.City != "sydney" || g.Offset != "1000" {
+		t.Errorf("v0 loaded as %+v %v", g, err)
+	}
+	if _, err := s.Guild("bad"); err == nil {
+		t.Errorf("loading a bad record didn't fail")
+	}
+
+	//Bad and newer sessions are skipped
+	loaded, err := s.Sessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != 1 || loaded["old"].Backend != "cafe" {
+		t.Errorf("sessions are %+v want only old", loaded)
+	}
+	s.Close()
+
+	//Opening again has nothing left to do
+	s, err = OpenBolt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+}
@@ -0,0 +1,79 @@
+package store
+
+import "sync"
+
+//Memory is a GuildStore which only lives as long as the process, handy for
+//tests and trying the bot out
+type Memory struct {
+	mu       sync.Mutex
+	guilds   map[string]Guild
+	sessions map[string]Session
+}
+
+//NewMemory returns an empty store
+func NewMemory() *Memory {
+	return &Memory{
+		guilds:   make(map[string]Guild),
+		sessions: make(map[string]Session),
+	}
+}
+
+//Guild returns the guild's record
+func (m *Memory) Guild(id string) (Guild, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	g, ok := m.guilds[id]
+	if !ok {
+		return Guild{}, ErrNotFound
+	}
+
+	return g.clone(), nil
+}
+
+//SetGuild saves the guild's record
+func (m *Memory) SetGuild(id string, g Guild) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	g.Migrate()
+	m.guilds[id] = g.clone()
+	return nil
+}
+
+//Sessions returns every saved session
+func (m *Memory) Sessions() (map[string]Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make(map[string]Session, len(m.sessions))
+	for id, s := range m.sessions {
+		result[id] = s
+	}
+
+	return result, nil
+}
+
+//SetSession saves the guild's session
+func (m *Memory) SetSession(id string, s Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s.Version = SessionVersion
+	m.sessions[id] = s
+	return nil
+}
+
+//DeleteSession forgets the guild's session
+func (m *Memory) DeleteSession(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, id)
+	return nil
+}
+
+//Close does nothing
+func (m *Memory) Close() error {
+	return nil
+}
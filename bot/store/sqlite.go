@@ -0,0 +1,218 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	//Pure go so the alpine image doesn't need cgo
+	_ "modernc.org/sqlite"
+)
+
+//sqliteMigrations are run in order to bring the database up to date, the
+//database's user_version is how many have been run. Only ever add to the
+//end.
+var sqliteMigrations = []string{
+	`CREATE TABLE guilds (
+		id          TEXT PRIMARY KEY,
+		version     INTEGER NOT NULL,
+		country     TEXT NOT NULL,
+		city        TEXT NOT NULL,
+		utc_offset  TEXT NOT NULL DEFAULT '',
+		timezone    TEXT NOT NULL DEFAULT '',
+		policy      TEXT NOT NULL DEFAULT '',
+		weights     TEXT NOT NULL DEFAULT '',
+		no_repeat   INTEGER NOT NULL DEFAULT 0,
+		default_set TEXT NOT NULL DEFAULT '',
+		wacky       INTEGER NOT NULL DEFAULT 0,
+		volume      INTEGER NOT NULL DEFAULT 100,
+		bell        INTEGER NOT NULL DEFAULT 1
+	);
+	CREATE TABLE sessions (
+		guild_id   TEXT PRIMARY KEY,
+		version    INTEGER NOT NULL,
+		channel_id TEXT NOT NULL,
+		backend    TEXT NOT NULL,
+		random     INTEGER NOT NULL DEFAULT 0,
+		reroll     INTEGER NOT NULL DEFAULT 0,
+		wacky      INTEGER NOT NULL DEFAULT 0
+	);`,
+	`ALTER TABLE guilds ADD COLUMN bell_volume INTEGER NOT NULL DEFAULT 100;`,
+}
+
+//SQLite is a GuildStore with a table per record type so guild data can be
+//queried with SQL
+type SQLite struct {
+	db *sql.DB
+}
+
+//OpenSQLite opens or creates the database at path bringing its tables up
+//to date
+func OpenSQLite(path string) (*SQLite, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	//SQLite only allows one writer anyway
+	db.SetMaxOpenConns(1)
+
+	result := &SQLite{db: db}
+	if err := result.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrating %s: %w", path, err)
+	}
+
+	return result, nil
+}
+
+func (s *SQLite) migrate() error {
+	var version int
+	if err := s.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	if version > len(sqliteMigrations) {
+		return fmt.Errorf(
+			"database is version %d but I only know %d", version, len(sqliteMigrations),
+		)
+	}
+
+	for ; version < len(sqliteMigrations); version++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(sqliteMigrations[version]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", version+1, err)
+		}
+		//PRAGMA can't take parameters
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//Guild returns the guild's record
+func (s *SQLite) Guild(id string) (Guild, error) {
+	var g Guild
+	var weights string
+	err := s.db.QueryRow(
+		`SELECT version, country, city, utc_offset, timezone, policy, weights,
+			no_repeat, default_set, wacky, volume, bell, bell_volume
+		FROM guilds WHERE id = ?`, id,
+	).Scan(
+		&g.Version, &g.Country, &g.City, &g.Offset, &g.Timezone, &g.Policy, &weights,
+		&g.NoRepeat, &g.Preferences.DefaultSet, &g.Preferences.Wacky,
+		&g.Preferences.Volume, &g.Preferences.Bell, &g.Preferences.BellVolume,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Guild{}, ErrNotFound
+	}
+	if err != nil {
+		return Guild{}, err
+	}
+
+	if weights != "" {
+		if err := json.Unmarshal([]byte(weights), &g.Weights); err != nil {
+			return Guild{}, fmt.Errorf("bad weights for %s: %w", id, err)
+		}
+	}
+
+	//Columns added by later migrations have their defaults already
+	g.Migrate()
+	return g, nil
+}
+
+//SetGuild saves the guild's record
+func (s *SQLite) SetGuild(id string, g Guild) error {
+	g.Migrate()
+
+	var weights string
+	if len(g.Weights) > 0 {
+		b, err := json.Marshal(g.Weights)
+		if err != nil {
+			return err
+		}
+		weights = string(b)
+	}
+
+	_, err := s.db.Exec(
+		`INSERT INTO guilds (
+			id, version, country, city, utc_offset, timezone, policy, weights,
+			no_repeat, default_set, wacky, volume, bell, bell_volume
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			version = excluded.version, country = excluded.country,
+			city = excluded.city, utc_offset = excluded.utc_offset,
+			timezone = excluded.timezone, policy = excluded.policy,
+			weights = excluded.weights, no_repeat = excluded.no_repeat,
+			default_set = excluded.default_set, wacky = excluded.wacky,
+			volume = excluded.volume, bell = excluded.bell,
+			bell_volume = excluded.bell_volume`,
+		id, g.Version, g.Country, g.City, g.Offset, g.Timezone, g.Policy, weights,
+		g.NoRepeat, g.Preferences.DefaultSet, g.Preferences.Wacky,
+		g.Preferences.Volume, g.Preferences.Bell, g.Preferences.BellVolume,
+	)
+	return err
+}
+
+//Sessions returns every saved session
+func (s *SQLite) Sessions() (map[string]Session, error) {
+	rows, err := s.db.Query(
+		`SELECT guild_id, version, channel_id, backend, random, reroll, wacky
+		FROM sessions`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[string]Session)
+	for rows.Next() {
+		var id string
+		var session Session
+		err := rows.Scan(
+			&id, &session.Version, &session.ChannelID, &session.Backend,
+			&session.Random, &session.Reroll, &session.Wacky,
+		)
+		if err != nil {
+			return nil, err
+		}
+		result[id] = session
+	}
+
+	return result, rows.Err()
+}
+
+//SetSession saves the guild's session
+func (s *SQLite) SetSession(id string, session Session) error {
+	_, err := s.db.Exec(
+		`INSERT INTO sessions (guild_id, version, channel_id, backend, random, reroll, wacky)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (guild_id) DO UPDATE SET
+			version = excluded.version, channel_id = excluded.channel_id,
+			backend = excluded.backend, random = excluded.random,
+			reroll = excluded.reroll, wacky = excluded.wacky`,
+		id, SessionVersion, session.ChannelID, session.Backend,
+		session.Random, session.Reroll, session.Wacky,
+	)
+	return err
+}
+
+//DeleteSession forgets the guild's session
+func (s *SQLite) DeleteSession(id string) error {
+	_, err := s.db.Exec("DELETE FROM sessions WHERE guild_id = ?", id)
+	return err
+}
+
+//Close closes the database
+func (s *SQLite) Close() error {
+	return s.db.Close()
+}
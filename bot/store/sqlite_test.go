@@ -0,0 +1,107 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestSQLite(t *testing.T) {
+	s, err := OpenSQLite(filepath.Join(t.TempDir(), "vibes.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	testGuildStore(t, s)
+}
+
+//sqliteAt creates a database at path which has had the first version
+//migrations run
+func sqliteAt(t *testing.T, path string, version int) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < version && i < len(sqliteMigrations); i++ {
+		if _, err := db.Exec(sqliteMigrations[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Exec(fmt.Sprintf("PRAGMA user_version = %d", version)); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func TestSQLiteMigrate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vibes.db")
+	db := sqliteAt(t, path, 1)
+	_, err := db.Exec(
+		`INSERT INTO guilds (id, version, country, city, utc_offset, default_set, volume, bell)
+		VALUES ('1', 1, 'US', 'boston', '-0500', 'cafe', 40, 0)`,
+	)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := OpenSQLite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	var version int
+	if err := s.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	if version != len(sqliteMigrations) {
+		t.Errorf("database is version %d want %d", version, len(sqliteMigrations))
+	}
+
+	g, err := s.Guild("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Preferences{DefaultSet: "cafe", Volume: 40, Bell: false, BellVolume: DefaultVolume}
+	if g.Version != GuildVersion || g.Preferences != want || g.Offset != "-0500" {
+		t.Errorf("migrated guild is %+v", g)
+	}
+}
+
+func TestSQLiteMigrateVersions(t *testing.T) {
+	tests := []struct {
+		version int
+		wantErr bool
+	}{
+		{version: 0},
+		{version: 1},
+		{version: len(sqliteMigrations)},
+		{version: len(sqliteMigrations) + 1, wantErr: true},
+	}
+
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), "vibes.db")
+		sqliteAt(t, path, test.version).Close()
+
+		s, err := OpenSQLite(path)
+		if test.wantErr {
+			if err == nil {
+				s.Close()
+				t.Errorf("opening version %d didn't fail", test.version)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("opening version %d failed: %v", test.version, err)
+			continue
+		}
+		testGuildStore(t, s)
+		s.Close()
+	}
+}
@@ -0,0 +1,143 @@
+//Package store keeps each guild's settings and the session it was playing
+//so they survive restarts. Records are versioned so old ones can be
+//upgraded as fields are added.
+package store
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	//GuildVersion is the version of Guild records this writes
+	//
+	//0 is country, city and offset from before records had a version
+	//1 adds preferences
+	//2 adds the bell's volume
+	GuildVersion = 2
+	//SessionVersion is the version of Session records this writes
+	SessionVersion = 1
+	//DefaultVolume is the percentage of the normal volume guilds start at
+	DefaultVolume = 100
+	//MaxVolume is the loudest a guild can go as a percentage
+	MaxVolume = 200
+)
+
+//ErrNotFound is returned when a guild doesn't have a record
+var ErrNotFound = errors.New("not found")
+
+//Guild is a guild's settings
+type Guild struct {
+	Country string `json:"country"`
+	City    string `json:"city"`
+	//Offset is a fixed offset like -0500 for guilds setup before Timezone
+	Offset   string `json:"offset,omitempty"`
+	Timezone string `json:"timezone,omitempty"`
+	//Policy is how sets are picked see rotation.NewPolicy
+	Policy   string         `json:"policy,omitempty"`
+	Weights  map[string]int `json:"weights,omitempty"`
+	NoRepeat int            `json:"no_repeat,omitempty"`
+	//Version is the schema version see GuildVersion
+	Version     int         `json:"version"`
+	Preferences Preferences `json:"preferences"`
+}
+
+//Preferences are the defaults a guild has picked
+type Preferences struct {
+	//DefaultSet is the backend /start uses when one isn't given
+	DefaultSet string `json:"default_set,omitempty"`
+	Wacky      bool   `json:"wacky"`
+	//Volume is a percentage of the normal volume for the music
+	Volume int  `json:"volume"`
+	Bell   bool `json:"bell"`
+	//BellVolume is a percentage of the normal volume for the bell
+	BellVolume int `json:"bell_volume"`
+}
+
+//DefaultPreferences is what guilds start with
+func DefaultPreferences() Preferences {
+	return Preferences{Volume: DefaultVolume, Bell: true, BellVolume: DefaultVolume}
+}
+
+//NewGuild returns an empty guild record at the current version
+func NewGuild() Guild {
+	return Guild{Version: GuildVersion, Preferences: DefaultPreferences()}
+}
+
+//Migrate upgrades the record to GuildVersion returning true if it changed
+func (g *Guild) Migrate() bool {
+	if g.Version >= GuildVersion {
+		return false
+	}
+
+	switch g.Version {
+	case 0:
+		g.Preferences = DefaultPreferences()
+	case 1:
+		g.Preferences.BellVolume = DefaultVolume
+	}
+
+	g.Version = GuildVersion
+	return true
+}
+
+func (g Guild) clone() Guild {
+	if g.Weights != nil {
+		weights := make(map[string]int, len(g.Weights))
+		for k, v := range g.Weights {
+			weights[k] = v
+		}
+		g.Weights = weights
+	}
+
+	return g
+}
+
+//Session is what's needed to start a guild's session again after a restart
+type Session struct {
+	//Version is the schema version see SessionVersion
+	Version   int    `json:"version"`
+	ChannelID string `json:"channel_id"`
+	//Backend is the one random picked when Random is set
+	Backend string `json:"backend"`
+	Random  bool   `json:"random,omitempty"`
+	Reroll  bool   `json:"reroll,omitempty"`
+	Wacky   bool   `json:"wacky,omitempty"`
+}
+
+//GuildStore saves guilds and their sessions, it must be safe to use from
+//many goroutines
+type GuildStore interface {
+	//Guild returns ErrNotFound if the guild hasn't been setup
+	Guild(id string) (Guild, error)
+	SetGuild(id string, g Guild) error
+	//Sessions returns every saved session by guild
+	Sessions() (map[string]Session, error)
+	SetSession(id string, s Session) error
+	DeleteSession(id string) error
+	Close() error
+}
+
+//Names of the stores for Open
+const (
+	BoltStore   = "bolt"
+	SQLiteStore = "sqlite"
+	MemoryStore = "memory"
+)
+
+//Open opens the named store at path, an empty name is bolt. The memory
+//store ignores path and forgets everything on exit.
+func Open(name, path string) (GuildStore, error) {
+	switch name {
+	case "", BoltStore:
+		return OpenBolt(path)
+	case SQLiteStore:
+		return OpenSQLite(path)
+	case MemoryStore:
+		return NewMemory(), nil
+	}
+
+	return nil, fmt.Errorf(
+		"unknown store %s must be one of %s, %s or %s", name, BoltStore, SQLiteStore, MemoryStore,
+	)
+}
@@ -0,0 +1,131 @@
+package store
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGuildMigrate(t *testing.T) {
+	tests := []struct {
+		name    string
+		guild   Guild
+		want    Guild
+		changed bool
+	}{
+		{
+			name:  "version 0 gets default preferences",
+			guild: Guild{Country: "AU", City: "sydney", Offset: "1000"},
+			want: Guild{
+				Country: "AU", City: "sydney", Offset: "1000",
+				Version: GuildVersion, Preferences: DefaultPreferences(),
+			},
+			changed: true,
+		},
+		{
+			name: "version 1 gets the bell volume",
+			guild: Guild{Version: 1, Preferences: Preferences{
+				DefaultSet: "cafe", Wacky: true, Volume: 40, Bell: false,
+			}},
+			want: Guild{Version: GuildVersion, Preferences: Preferences{
+				DefaultSet: "cafe", Wacky: true, Volume: 40, Bell: false, BellVolume: DefaultVolume,
+			}},
+			changed: true,
+		},
+		{
+			name:  "current is left alone",
+			guild: Guild{Version: GuildVersion, Preferences: Preferences{Volume: 10, BellVolume: 20}},
+			want:  Guild{Version: GuildVersion, Preferences: Preferences{Volume: 10, BellVolume: 20}},
+		},
+		{
+			name:  "newer is left alone",
+			guild: Guild{Version: GuildVersion + 1},
+			want:  Guild{Version: GuildVersion + 1},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := test.guild
+			if changed := g.Migrate(); changed != test.changed {
+				t.Errorf("Migrate() = %v want %v", changed, test.changed)
+			}
+			if !reflect.DeepEqual(g, test.want) {
+				t.Errorf("got %+v want %+v", g, test.want)
+			}
+		})
+	}
+}
+
+func TestOpen(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"", BoltStore, SQLiteStore, MemoryStore} {
+		s, err := Open(name, filepath.Join(dir, name+".db"))
+		if err != nil {
+			t.Errorf("Open(%q) failed: %v", name, err)
+			continue
+		}
+		s.Close()
+	}
+
+	if _, err := Open("postgres", ""); err == nil {
+		t.Errorf("Open of an unknown store didn't fail")
+	}
+}
+
+//testGuildStore checks s saves and loads records like every GuildStore must
+func testGuildStore(t *testing.T, s GuildStore) {
+	t.Helper()
+
+	if _, err := s.Guild("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Guild of a missing guild gave %v want ErrNotFound", err)
+	}
+
+	guild := NewGuild()
+	guild.Country, guild.City, guild.Timezone = "US", "new york", "America/New_York"
+	guild.Policy, guild.Weights, guild.NoRepeat = "weighted", map[string]int{"cafe": 3}, 2
+	guild.Preferences.DefaultSet, guild.Preferences.Volume = "cafe", 150
+	if err := s.SetGuild("1", guild); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Guild("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, guild) {
+		t.Errorf("got %+v want %+v", got, guild)
+	}
+
+	//Old records are upgraded when they're saved
+	if err := s.SetGuild("2", Guild{Country: "AU", City: "perth", Offset: "0800"}); err != nil {
+		t.Fatal(err)
+	}
+	got, err = s.Guild("2")
+	if err != nil || got.Version != GuildVersion || got.Preferences != DefaultPreferences() {
+		t.Errorf("old record saved as %+v %v", got, err)
+	}
+
+	session := Session{ChannelID: "c", Backend: "cafe", Random: true, Reroll: true, Wacky: true}
+	if err := s.SetSession("1", session); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetSession("2", Session{ChannelID: "d", Backend: "forest"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteSession("2"); err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := s.Sessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.Version = SessionVersion
+	if want := map[string]Session{"1": session}; !reflect.DeepEqual(sessions, want) {
+		t.Errorf("sessions are %+v want %+v", sessions, want)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	testGuildStore(t, NewMemory())
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sardap/vibes/bot/clock"
+
+	//Containers don't always ship a zoneinfo database
+	_ "time/tzdata"
+)
+
+const (
+	minOffset = -12 * time.Hour
+	maxOffset = 14 * time.Hour
+)
+
+var locations sync.Map
+
+//parseOffset parses a fixed offset like -0500 or 0930 from before
+//timezones were supported
+func parseOffset(offset string) (*time.Location, error) {
+	str := offset
+	if !strings.HasPrefix(str, "-") && !strings.HasPrefix(str, "+") {
+		str = "+" + str
+	}
+
+	t, err := time.Parse("-0700", str)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not an offset like -0500", offset)
+	}
+
+	_, seconds := t.Zone()
+	if d := time.Duration(seconds) * time.Second; d < minOffset || d > maxOffset {
+		return nil, fmt.Errorf("%s is not between -1200 and +1400", offset)
+	}
+
+	return time.FixedZone(str, seconds), nil
+}
+
+//loadLocation loads an IANA zone like America/New_York
+func loadLocation(name string) (*time.Location, error) {
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+
+	//LoadLocation treats these as UTC and Local which isn't what anyone wants
+	if name == "" || name == "Local" {
+		return nil, fmt.Errorf("%s is not a timezone", name)
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a timezone like America/New_York", name)
+	}
+	locations.Store(name, loc)
+
+	return loc, nil
+}
+
+//parseTimezone accepts either a zone name or a legacy offset, returning
+//which one it was
+func parseTimezone(str string) (timezone, offset string, err error) {
+	str = strings.TrimSpace(str)
+	if _, err := loadLocation(str); err == nil {
+		return str, "", nil
+	}
+
+	if _, offsetErr := parseOffset(str); offsetErr == nil {
+		return "", str, nil
+	}
+
+	return "", "", fmt.Errorf(
+		"%s is not a timezone like America/New_York or an offset like -0500", str,
+	)
+}
+
+//location returns the guild's timezone, guilds setup before timezones
+//were supported use their fixed offset
+func (i *guildInfo) location() *time.Location {
+	if i.Timezone != "" {
+		loc, err := loadLocation(i.Timezone)
+		if err == nil {
+			return loc
+		}
+		log.Printf("bad stored timezone %s: %v\n", i.Timezone, err)
+	}
+
+	loc, err := parseOffset(i.Offset)
+	if err != nil {
+		log.Printf("bad stored offset %s: %v\n", i.Offset, err)
+		return time.UTC
+	}
+
+	return loc
+}
+
+//localTime is the current time in the guild's timezone
+func (i *guildInfo) localTime(c clock.Clock) time.Time {
+	return c.Now().In(i.location())
+}
+
+//startOfHour truncates t to the hour in its own timezone, unlike
+//Truncate this works for zones which are not a whole number of hours off
+//UTC and doesn't get confused by repeated hours when clocks go back
+func startOfHour(t time.Time) time.Time {
+	return t.Add(-time.Duration(t.Minute())*time.Minute -
+		time.Duration(t.Second())*time.Second -
+		time.Duration(t.Nanosecond()))
+}
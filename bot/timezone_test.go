@@ -0,0 +1,146 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sardap/vibes/bot/clock"
+	"github.com/sardap/vibes/bot/store"
+)
+
+func TestParseOffset(t *testing.T) {
+	tests := []struct {
+		offset string
+		//seconds east of UTC
+		want    int
+		wantErr bool
+	}{
+		{offset: "-0500", want: -5 * 60 * 60},
+		{offset: "+0930", want: 9*60*60 + 30*60},
+		{offset: "0930", want: 9*60*60 + 30*60},
+		{offset: "1000", want: 10 * 60 * 60},
+		{offset: "+0545", want: 5*60*60 + 45*60},
+		{offset: "-1200", want: -12 * 60 * 60},
+		{offset: "+1400", want: 14 * 60 * 60},
+		{offset: "0000", want: 0},
+		{offset: "-1300", wantErr: true},
+		{offset: "+1401", wantErr: true},
+		{offset: "-05:00", wantErr: true},
+		{offset: "-5", wantErr: true},
+		{offset: "abc", wantErr: true},
+		{offset: "", wantErr: true},
+	}
+
+	for _, test := range tests {
+		loc, err := parseOffset(test.offset)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("parseOffset(%q) = %s want an error", test.offset, loc)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseOffset(%q) failed: %v", test.offset, err)
+			continue
+		}
+		if _, got := time.Date(2021, 1, 2, 0, 0, 0, 0, loc).Zone(); got != test.want {
+			t.Errorf("parseOffset(%q) is %ds off UTC want %ds", test.offset, got, test.want)
+		}
+	}
+}
+
+func TestParseTimezone(t *testing.T) {
+	tests := []struct {
+		str      string
+		timezone string
+		offset   string
+		wantErr  bool
+	}{
+		{str: "America/New_York", timezone: "America/New_York"},
+		{str: " Australia/Sydney ", timezone: "Australia/Sydney"},
+		{str: "UTC", timezone: "UTC"},
+		{str: "-0500", offset: "-0500"},
+		{str: "1000", offset: "1000"},
+		{str: "+0545", offset: "+0545"},
+		{str: "-1300", wantErr: true},
+		{str: "-05:00", wantErr: true},
+		{str: "Local", wantErr: true},
+		{str: "", wantErr: true},
+		{str: "Mars/Olympus_Mons", wantErr: true},
+	}
+
+	for _, test := range tests {
+		timezone, offset, err := parseTimezone(test.str)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("parseTimezone(%q) = %q %q want an error", test.str, timezone, offset)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseTimezone(%q) failed: %v", test.str, err)
+			continue
+		}
+		if timezone != test.timezone || offset != test.offset {
+			t.Errorf(
+				"parseTimezone(%q) = %q %q want %q %q",
+				test.str, timezone, offset, test.timezone, test.offset,
+			)
+		}
+	}
+}
+
+func TestLocalTime(t *testing.T) {
+	now := time.Date(2021, 7, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		info     guildInfo
+		wantHour int
+	}{
+		{guildInfo{store.Guild{Timezone: "America/New_York"}}, 8},
+		{guildInfo{store.Guild{Timezone: "Australia/Adelaide", Offset: "-0500"}}, 21},
+		{guildInfo{store.Guild{Offset: "-0500"}}, 7},
+		{guildInfo{store.Guild{Timezone: "Nowhere/Special", Offset: "+0100"}}, 13},
+		{guildInfo{store.Guild{Offset: "garbage"}}, 12},
+	}
+
+	clk := clock.NewFake(now)
+	for _, test := range tests {
+		if got := test.info.localTime(clk).Hour(); got != test.wantHour {
+			t.Errorf(
+				"%q %q local hour is %d want %d",
+				test.info.Timezone, test.info.Offset, got, test.wantHour,
+			)
+		}
+	}
+}
+
+func TestStartOfHour(t *testing.T) {
+	kathmandu, err := parseOffset("+0545")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		t    time.Time
+		want time.Time
+	}{
+		{
+			time.Date(2021, 1, 2, 14, 35, 12, 500, time.UTC),
+			time.Date(2021, 1, 2, 14, 0, 0, 0, time.UTC),
+		},
+		{
+			time.Date(2021, 1, 2, 14, 5, 0, 0, kathmandu),
+			time.Date(2021, 1, 2, 14, 0, 0, 0, kathmandu),
+		},
+		{
+			time.Date(2021, 1, 2, 0, 0, 0, 0, kathmandu),
+			time.Date(2021, 1, 2, 0, 0, 0, 0, kathmandu),
+		},
+	}
+
+	for _, test := range tests {
+		if got := startOfHour(test.t); !got.Equal(test.want) {
+			t.Errorf("startOfHour(%s) = %s want %s", test.t, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package vibes
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/sardap/vibes/bot/clock"
+)
+
+//ErrCircuitOpen calls are not being made since the endpoint keeps failing
+var ErrCircuitOpen = errors.New("circuit open")
+
+const (
+	//DefaultBreakerThreshold is how many transient failures in a row open
+	//the circuit
+	DefaultBreakerThreshold = 5
+	//DefaultBreakerCooldown is how long the circuit stays open before a
+	//single probe call is allowed through
+	DefaultBreakerCooldown = 30 * time.Second
+)
+
+var (
+	breakersMu sync.Mutex
+	breakers   = make(map[string]*Breaker)
+)
+
+//Breaker is a circuit breaker for one endpoint, while open every call
+//fails fast with ErrCircuitOpen. The zero value uses the defaults.
+type Breaker struct {
+	//Threshold is DefaultBreakerThreshold when not positive
+	Threshold int
+	//Cooldown is DefaultBreakerCooldown when not positive
+	Cooldown time.Duration
+	//Clock tells the breaker the time, the real clock when nil
+	Clock clock.Clock
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+//BreakerFor returns the breaker shared by every Invoker using endpoint
+func BreakerFor(endpoint string) *Breaker {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+
+	result, ok := breakers[endpoint]
+	if !ok {
+		result = &Breaker{
+			Threshold: DefaultBreakerThreshold,
+			Cooldown:  DefaultBreakerCooldown,
+		}
+		breakers[endpoint] = result
+	}
+
+	return result
+}
+
+func (b *Breaker) clock() clock.Clock {
+	if b.Clock != nil {
+		return b.Clock
+	}
+
+	return clock.Real{}
+}
+
+func (b *Breaker) threshold() int {
+	if b.Threshold > 0 {
+		return b.Threshold
+	}
+
+	return DefaultBreakerThreshold
+}
+
+func (b *Breaker) cooldown() time.Duration {
+	if b.Cooldown > 0 {
+		return b.Cooldown
+	}
+
+	return DefaultBreakerCooldown
+}
+
+func (b *Breaker) open() bool {
+	return b.failures >= b.threshold()
+}
+
+//allow reports if a call can be made now, once the cooldown is over a
+//single probe is let through to decide if the circuit closes
+func (b *Breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.open() {
+		return true
+	}
+	if b.probing || b.clock().Now().Before(b.openUntil) {
+		return false
+	}
+
+	b.probing = true
+	return true
+}
+
+//record updates the breaker with the result of a call
+func (b *Breaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if errors.Is(err, context.Canceled) {
+		//The caller gave up which says nothing about the endpoint
+		return
+	}
+	if !retryable(err) {
+		//Anything else is the endpoint answering even if it's a 404
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.open() {
+		b.openUntil = b.clock().Now().Add(b.cooldown())
+	}
+}
+
+//Closed reports if calls are currently going through
+func (b *Breaker) Closed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return !b.open()
+}
+
+//Wait blocks until the breaker would let a call through or ctx is done
+func (b *Breaker) Wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		wait := time.Duration(0)
+		if b.open() {
+			wait = b.openUntil.Sub(b.clock().Now())
+			if wait <= 0 && b.probing {
+				//Someone else is probing check back shortly
+				wait = time.Second
+			}
+		}
+		b.mu.Unlock()
+
+		if wait <= 0 {
+			return ctx.Err()
+		}
+		select {
+		case <-b.clock().After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
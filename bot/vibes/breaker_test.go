@@ -0,0 +1,171 @@
+package vibes
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sardap/vibes/bot/clock"
+)
+
+func TestBreaker(t *testing.T) {
+	fake := clock.NewFake(time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC))
+	b := &Breaker{Threshold: 3, Cooldown: 30 * time.Second, Clock: fake}
+	failure := &Error{Kind: ErrServer}
+
+	steps := []struct {
+		name string
+		//advance moves the clock before the step
+		advance time.Duration
+		//record is the result of the call if it's allowed
+		record    error
+		wantAllow bool
+		//wantClosed is after recording
+		wantClosed bool
+	}{
+		{"first failure", 0, failure, true, true},
+		{"second failure", 0, failure, true, true},
+		{"not found is an answer", 0, &Error{Kind: ErrNotFound}, true, true},
+		{"counting starts again", 0, failure, true, true},
+		{"cancelled doesn't count", 0, &Error{Err: context.Canceled}, true, true},
+		{"second failure again", 0, failure, true, true},
+		{"third failure opens", 0, failure, true, false},
+		{"open fails fast", 29 * time.Second, nil, false, false},
+		{"probe after cooldown fails", time.Second, failure, true, false},
+		{"failed probe starts another cooldown", 29 * time.Second, nil, false, false},
+		{"probe succeeds", time.Second, nil, true, true},
+		{"closed again", 0, failure, true, true},
+	}
+
+	for _, step := range steps {
+		fake.Advance(step.advance)
+		allowed := b.allow()
+		if allowed != step.wantAllow {
+			t.Fatalf("%s: allow() = %v want %v", step.name, allowed, step.wantAllow)
+		}
+		if allowed {
+			b.record(step.record)
+		}
+		if closed := b.Closed(); closed != step.wantClosed {
+			t.Fatalf("%s: Closed() = %v want %v", step.name, closed, step.wantClosed)
+		}
+	}
+}
+
+func TestBreakerZeroValue(t *testing.T) {
+	fake := clock.NewFake(time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC))
+	b := &Breaker{Clock: fake}
+
+	for i := 0; i < DefaultBreakerThreshold; i++ {
+		if !b.allow() {
+			t.Fatalf("call %d refused before the default threshold", i+1)
+		}
+		b.record(&Error{Kind: ErrServer})
+	}
+	if b.Closed() || b.allow() {
+		t.Fatal("breaker didn't open at the default threshold")
+	}
+
+	fake.Advance(DefaultBreakerCooldown - time.Second)
+	if b.allow() {
+		t.Fatal("probe allowed before the default cooldown")
+	}
+	fake.Advance(time.Second)
+	if !b.allow() {
+		t.Fatal("probe not allowed after the default cooldown")
+	}
+}
+
+func TestBreakerProbeAnswered(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantClosed bool
+	}{
+		{"ok", nil, true},
+		{"not found", &Error{Kind: ErrNotFound, StatusCode: 404}, true},
+		{"unauthorized", &Error{Kind: ErrUnauthorized, StatusCode: 401}, true},
+		{"server error", &Error{Kind: ErrServer, StatusCode: 500}, false},
+		{"cancelled", &Error{Err: context.Canceled}, false},
+	}
+
+	for _, test := range tests {
+		fake := clock.NewFake(time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC))
+		b := &Breaker{Threshold: 1, Cooldown: time.Minute, Clock: fake}
+		b.record(&Error{Kind: ErrTimeout})
+		fake.Advance(time.Minute)
+
+		if !b.allow() {
+			t.Fatalf("%s: probe not allowed", test.name)
+		}
+		b.record(test.err)
+		if b.Closed() != test.wantClosed {
+			t.Errorf("%s: Closed() = %v after the probe want %v", test.name, b.Closed(), test.wantClosed)
+		}
+		//Either way the next probe isn't blocked forever
+		if !test.wantClosed && test.err != nil {
+			fake.Advance(time.Minute)
+			if !b.allow() {
+				t.Errorf("%s: no probe allowed after another cooldown", test.name)
+			}
+		}
+	}
+}
+
+func TestBreakerSingleProbe(t *testing.T) {
+	fake := clock.NewFake(time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC))
+	b := &Breaker{Threshold: 1, Cooldown: time.Minute, Clock: fake}
+	b.record(&Error{Kind: ErrTimeout})
+
+	fake.Advance(time.Minute)
+	if !b.allow() {
+		t.Fatal("probe not allowed after the cooldown")
+	}
+	if b.allow() {
+		t.Fatal("second call allowed while probing")
+	}
+	b.record(nil)
+	if !b.allow() || !b.Closed() {
+		t.Fatal("breaker didn't close after a good probe")
+	}
+}
+
+func TestBreakerWait(t *testing.T) {
+	fake := clock.NewFake(time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC))
+	b := &Breaker{Threshold: 1, Cooldown: time.Minute, Clock: fake}
+
+	if err := b.Wait(context.Background()); err != nil {
+		t.Fatalf("waiting on a closed breaker failed: %v", err)
+	}
+
+	b.record(&Error{Kind: ErrServer})
+	done := make(chan error, 1)
+	go func() {
+		done <- b.Wait(context.Background())
+	}()
+
+	fake.BlockUntil(1)
+	fake.Advance(59 * time.Second)
+	select {
+	case err := <-done:
+		t.Fatalf("Wait returned %v before the cooldown", err)
+	default:
+	}
+	fake.Advance(time.Second)
+	if err := <-done; err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+
+	//Cancelling gives up waiting
+	b.record(&Error{Kind: ErrServer})
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		done <- b.Wait(ctx)
+	}()
+	fake.BlockUntil(1)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled Wait returned %v", err)
+	}
+}
@@ -0,0 +1,277 @@
+package vibes
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sardap/vibes/bot/flight"
+)
+
+const (
+	sampleExt = ".sample"
+	metaExt   = ".json"
+)
+
+//Cache is an on disk LRU cache of samples, every Invoker sharing a Cache
+//shares fetches so guilds in the same city only download a sample once
+type Cache struct {
+	dir      string
+	maxBytes int64
+	maxAge   time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	size    int64
+	group   flight.Group[struct{}]
+}
+
+type cacheEntry struct {
+	Key          string    `json:"key"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	Fetched      time.Time `json:"fetched"`
+	Size         int64     `json:"size"`
+}
+
+//NewCache creates a cache in dir holding at most maxBytes, entries younger
+//than maxAge are served without asking the backend, older ones are
+//revalidated with their ETag or Last-Modified. dir must only be used by the
+//cache, files in it the cache doesn't recognise are deleted.
+func NewCache(dir string, maxBytes int64, maxAge time.Duration) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	result := &Cache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		maxAge:   maxAge,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+	if err := result.load(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+//load rebuilds the index from what a previous run left on disk
+func (c *Cache) load() error {
+	//Downloads interrupted by a crash
+	partial, _ := filepath.Glob(filepath.Join(c.dir, "download-*"))
+	for _, path := range partial {
+		os.Remove(path)
+	}
+
+	metas, err := filepath.Glob(filepath.Join(c.dir, "*"+metaExt))
+	if err != nil {
+		return err
+	}
+
+	loaded := make([]*cacheEntry, 0, len(metas))
+	for _, path := range metas {
+		var entry cacheEntry
+		b, err := ioutil.ReadFile(path)
+		if err == nil {
+			err = json.Unmarshal(b, &entry)
+		}
+		if err != nil || c.fileName(entry.Key) != strings.TrimSuffix(path, metaExt) {
+			c.removeFiles(strings.TrimSuffix(path, metaExt))
+			continue
+		}
+		if info, err := os.Stat(c.fileName(entry.Key) + sampleExt); err != nil || info.Size() != entry.Size {
+			c.removeFiles(c.fileName(entry.Key))
+			continue
+		}
+		loaded = append(loaded, &entry)
+	}
+
+	//Oldest fetch is the least recently used as far as we know
+	sort.Slice(loaded, func(i, j int) bool {
+		return loaded[i].Fetched.After(loaded[j].Fetched)
+	})
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, entry := range loaded {
+		c.entries[entry.Key] = c.lru.PushBack(entry)
+		c.size += entry.Size
+	}
+	c.evict("")
+
+	return nil
+}
+
+func (c *Cache) fileName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:]))
+}
+
+func (c *Cache) removeFiles(base string) {
+	os.Remove(base + sampleExt)
+	os.Remove(base + metaExt)
+}
+
+//evict drops least recently used entries until under the cap, keep is
+//never evicted, must hold mu
+func (c *Cache) evict(keep string) {
+	for c.maxBytes > 0 && c.size > c.maxBytes {
+		elem := c.lru.Back()
+		for elem != nil && elem.Value.(*cacheEntry).Key == keep {
+			elem = elem.Prev()
+		}
+		if elem == nil {
+			return
+		}
+
+		entry := elem.Value.(*cacheEntry)
+		c.lru.Remove(elem)
+		delete(c.entries, entry.Key)
+		c.size -= entry.Size
+		c.removeFiles(c.fileName(entry.Key))
+	}
+}
+
+//lookup returns a copy of the entry and marks it as used
+func (c *Cache) lookup(key string) (cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return cacheEntry{}, false
+	}
+	c.lru.MoveToFront(elem)
+
+	return *elem.Value.(*cacheEntry), true
+}
+
+func (c *Cache) store(entry *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[entry.Key]; ok {
+		c.size -= elem.Value.(*cacheEntry).Size
+		c.lru.Remove(elem)
+	}
+	c.entries[entry.Key] = c.lru.PushFront(entry)
+	c.size += entry.Size
+	c.evict(entry.Key)
+}
+
+func (c *Cache) open(key string) (io.ReadCloser, error) {
+	return os.Open(c.fileName(key) + sampleExt)
+}
+
+//fetchFunc performs a conditional request for the key using the validators
+//in header, a not modified response means the cached copy is still good
+type fetchFunc func(ctx context.Context, header http.Header) (*http.Response, error)
+
+//get returns the cached body for key refreshing it with fetch if needed,
+//concurrent callers for the same key share one fetch which is cancelled
+//once all of them have given up
+func (c *Cache) get(ctx context.Context, key string, fetch fetchFunc) (io.ReadCloser, error) {
+	if entry, ok := c.lookup(key); ok && time.Since(entry.Fetched) < c.maxAge {
+		if f, err := c.open(key); err == nil {
+			return f, nil
+		}
+	}
+
+	_, err := c.group.Do(ctx, key, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, c.refresh(ctx, key, fetch)
+	})
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		//A stale sample beats silence
+		if _, ok := c.lookup(key); ok && Temporary(err) {
+			if f, err := c.open(key); err == nil {
+				return f, nil
+			}
+		}
+		return nil, err
+	}
+
+	return c.open(key)
+}
+
+func (c *Cache) refresh(ctx context.Context, key string, fetch fetchFunc) error {
+	header := make(http.Header)
+	old, cached := c.lookup(key)
+	if cached {
+		if old.ETag != "" {
+			header.Set("If-None-Match", old.ETag)
+		}
+		if old.LastModified != "" {
+			header.Set("If-Modified-Since", old.LastModified)
+		}
+	}
+
+	resp, err := fetch(ctx, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		if !cached {
+			return fmt.Errorf("not modified response for uncached %s", key)
+		}
+		old.Fetched = time.Now()
+		return c.writeEntry(&old)
+	}
+
+	base := c.fileName(key)
+	tmp, err := ioutil.TempFile(c.dir, "download-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	size, err := io.Copy(tmp, resp.Body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return &Error{URL: key, Err: err}
+	}
+	if err := os.Rename(tmp.Name(), base+sampleExt); err != nil {
+		return err
+	}
+
+	return c.writeEntry(&cacheEntry{
+		Key:          key,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Fetched:      time.Now(),
+		Size:         size,
+	})
+}
+
+func (c *Cache) writeEntry(entry *cacheEntry) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(c.fileName(entry.Key)+metaExt, b, 0644); err != nil {
+		return err
+	}
+
+	c.store(entry)
+	return nil
+}
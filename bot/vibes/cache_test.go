@@ -0,0 +1,233 @@
+package vibes
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//testBackend serves bodies for keys counting how often each is fetched
+type testBackend struct {
+	mu      sync.Mutex
+	bodies  map[string]string
+	fetches map[string]int
+	//err is returned instead of a response when set
+	err error
+	//headers are the request headers of the last fetch
+	headers http.Header
+}
+
+func newTestBackend(bodies map[string]string) *testBackend {
+	return &testBackend{bodies: bodies, fetches: make(map[string]int)}
+}
+
+func (b *testBackend) fetch(key string) fetchFunc {
+	return func(ctx context.Context, header http.Header) (*http.Response, error) {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		b.fetches[key]++
+		b.headers = header
+		if b.err != nil {
+			return nil, b.err
+		}
+		if etag := "\"" + b.bodies[key] + "\""; header.Get("If-None-Match") == etag {
+			return &http.Response{
+				StatusCode: http.StatusNotModified,
+				Header:     make(http.Header),
+				Body:       io.NopCloser(strings.NewReader("")),
+			}, nil
+		}
+
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Etag": {"\"" + b.bodies[key] + "\""}},
+			Body:       io.NopCloser(strings.NewReader(b.bodies[key])),
+		}, nil
+	}
+}
+
+func (b *testBackend) count(key string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.fetches[key]
+}
+
+//read gets key from the cache failing the test if it can't
+func read(t *testing.T, c *Cache, key string, fetch fetchFunc) string {
+	t.Helper()
+
+	r, err := c.get(context.Background(), key, fetch)
+	if err != nil {
+		t.Fatalf("getting %s failed: %v", key, err)
+	}
+	defer r.Close()
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(b)
+}
+
+func TestCacheEviction(t *testing.T) {
+	dir := t.TempDir()
+	c, err := NewCache(dir, 10, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := newTestBackend(map[string]string{
+		"a": "aaaa", "b": "bbbb", "c": "cccc", "big": "0123456789ab",
+	})
+
+	steps := []struct {
+		key string
+		//wantFetches is how many times key has been fetched after the get
+		wantFetches int
+	}{
+		{"a", 1},
+		{"b", 1},
+		//Using a makes b the least recently used
+		{"a", 1},
+		{"c", 1},
+		{"a", 1},
+		{"b", 2},
+		//Bigger than the whole cache but kept until something else comes
+		{"big", 1},
+		{"big", 1},
+		{"c", 2},
+	}
+	for i, step := range steps {
+		if got := read(t, c, step.key, backend.fetch(step.key)); got != backend.bodies[step.key] {
+			t.Fatalf("step %d got %q for %s", i, got, step.key)
+		}
+		if got := backend.count(step.key); got != step.wantFetches {
+			t.Fatalf("step %d %s fetched %d times want %d", i, step.key, got, step.wantFetches)
+		}
+	}
+
+	//Evicted entries are removed from disk
+	files, _ := filepath.Glob(filepath.Join(dir, "*"+sampleExt))
+	if len(files) != 1 {
+		t.Errorf("%d samples on disk want 1", len(files))
+	}
+	if _, err := os.Stat(c.fileName("c") + sampleExt); err != nil {
+		t.Errorf("c isn't on disk: %v", err)
+	}
+}
+
+func TestCacheStaleOnError(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		wantErr bool
+	}{
+		{"server error", &Error{Kind: ErrServer, StatusCode: 500}, false},
+		{"timeout", &Error{Kind: ErrTimeout}, false},
+		{"circuit open", &Error{Kind: ErrCircuitOpen}, false},
+		{"not found", &Error{Kind: ErrNotFound, StatusCode: 404}, true},
+		{"unauthorized", &Error{Kind: ErrUnauthorized, StatusCode: 401}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			//Everything is stale straight away
+			c, err := NewCache(t.TempDir(), 0, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			backend := newTestBackend(map[string]string{"a": "aaaa"})
+			read(t, c, "a", backend.fetch("a"))
+
+			backend.err = test.err
+			r, err := c.get(context.Background(), "a", backend.fetch("a"))
+			if test.wantErr {
+				if !errors.Is(err, test.err) {
+					t.Errorf("got %v want %v", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("stale sample not served: %v", err)
+			}
+			defer r.Close()
+			if b, _ := io.ReadAll(r); string(b) != "aaaa" {
+				t.Errorf("got %q want the stale sample", b)
+			}
+		})
+	}
+}
+
+func TestCacheUncachedError(t *testing.T) {
+	c, err := NewCache(t.TempDir(), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := newTestBackend(map[string]string{"a": "aaaa"})
+	backend.err = &Error{Kind: ErrServer}
+
+	if _, err := c.get(context.Background(), "a", backend.fetch("a")); !errors.Is(err, ErrServer) {
+		t.Errorf("got %v want a server error with nothing cached", err)
+	}
+}
+
+func TestCacheRevalidate(t *testing.T) {
+	c, err := NewCache(t.TempDir(), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := newTestBackend(map[string]string{"a": "aaaa"})
+
+	read(t, c, "a", backend.fetch("a"))
+	if got := read(t, c, "a", backend.fetch("a")); got != "aaaa" {
+		t.Errorf("got %q after not modified", got)
+	}
+	if got := backend.headers.Get("If-None-Match"); got != "\"aaaa\"" {
+		t.Errorf("revalidated with If-None-Match %q", got)
+	}
+
+	backend.bodies["a"] = "new"
+	if got := read(t, c, "a", backend.fetch("a")); got != "new" {
+		t.Errorf("got %q after it changed", got)
+	}
+}
+
+func TestCacheReload(t *testing.T) {
+	dir := t.TempDir()
+	c, err := NewCache(dir, 0, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := newTestBackend(map[string]string{"a": "aaaa", "b": "bbbb"})
+	read(t, c, "a", backend.fetch("a"))
+	read(t, c, "b", backend.fetch("b"))
+
+	//Leftovers from a crash and a sample which doesn't match its record
+	os.WriteFile(filepath.Join(dir, "download-123"), []byte("partial"), 0644)
+	os.WriteFile(filepath.Join(dir, "junk"+metaExt), []byte("{"), 0644)
+	os.WriteFile(c.fileName("b")+sampleExt, []byte("truncated"), 0644)
+
+	c, err = NewCache(dir, 0, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read(t, c, "a", backend.fetch("a"))
+	read(t, c, "b", backend.fetch("b"))
+	if backend.count("a") != 1 || backend.count("b") != 2 {
+		t.Errorf("fetched a %d and b %d times want 1 and 2", backend.count("a"), backend.count("b"))
+	}
+
+	for _, name := range []string{"download-123", "junk" + metaExt} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s wasn't cleaned up", name)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package vibes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+var (
+	//ErrNotFound backend does not know the requested resource
+	ErrNotFound = errors.New("not found")
+	//ErrUnauthorized backend rejected the access key or credentials
+	ErrUnauthorized = errors.New("unauthorized")
+	//ErrServer backend failed to handle the request
+	ErrServer = errors.New("server error")
+	//ErrDecode backend response could not be decoded
+	ErrDecode = errors.New("unable to decode response")
+	//ErrTimeout backend did not respond before the deadline
+	ErrTimeout = errors.New("timed out")
+	//ErrStream a stream from the backend couldn't be used all the way
+	//through, like ffmpeg failing part way through encoding it
+	ErrStream = errors.New("stream failed")
+)
+
+const maxErrorBody = 256
+
+//Error describes a failed call to a backend, it matches one of the
+//sentinel errors with errors.Is
+type Error struct {
+	//Kind is one of the sentinel errors or nil if none apply
+	Kind error
+	//StatusCode is zero if no response was received
+	StatusCode int
+	//URL with the access key and credentials removed
+	URL string
+	//Body is the start of the response body for unexpected status codes
+	Body string
+	//Err is the underlying cause if there is one
+	Err error
+}
+
+func (e *Error) Error() string {
+	msg := "unable to use stream"
+	if e.URL != "" {
+		msg = fmt.Sprintf("unable to fetch %s", e.URL)
+	}
+	if e.Kind != nil {
+		msg = fmt.Sprintf("%s: %v", msg, e.Kind)
+	}
+	if e.StatusCode != 0 {
+		msg = fmt.Sprintf("%s status %d", msg, e.StatusCode)
+	}
+	if e.Body != "" {
+		msg = fmt.Sprintf("%s body %s", msg, e.Body)
+	}
+	if e.Err != nil {
+		msg = fmt.Sprintf("%s: %v", msg, e.Err)
+	}
+
+	return msg
+}
+
+//Is reports if target is the kind of this error
+func (e *Error) Is(target error) bool {
+	return e.Kind != nil && target == e.Kind
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+//redactURL returns the url without anything secret in it
+func redactURL(u url.URL) string {
+	u.User = nil
+	q := u.Query()
+	if q.Has("access_key") {
+		q.Set("access_key", "REDACTED")
+		u.RawQuery = q.Encode()
+	}
+
+	return u.String()
+}
+
+func statusKind(code int) error {
+	switch {
+	case code == http.StatusNotFound:
+		return ErrNotFound
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return ErrUnauthorized
+	case code >= 500:
+		return ErrServer
+	}
+
+	return nil
+}
+
+//transportError converts an error from the http client, the url.Error is
+//unwrapped since its message contains the access key
+func transportError(u url.URL, err error) *Error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+
+	result := &Error{URL: redactURL(u), Err: err}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) ||
+		(errors.As(err, &netErr) && netErr.Timeout()) {
+		result.Kind = ErrTimeout
+	}
+
+	return result
+}
+
+func statusError(u url.URL, code int, body []byte) *Error {
+	if len(body) > maxErrorBody {
+		body = body[:maxErrorBody]
+	}
+
+	return &Error{
+		Kind:       statusKind(code),
+		StatusCode: code,
+		URL:        redactURL(u),
+		Body:       string(body),
+	}
+}
+
+func decodeError(u url.URL, err error) error {
+	if err == nil {
+		return nil
+	}
+	//Reading the body already failed
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return transportError(u, err)
+	}
+
+	return &Error{Kind: ErrDecode, URL: redactURL(u), Err: err}
+}
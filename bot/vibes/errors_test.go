@@ -0,0 +1,40 @@
+package vibes
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatusErrors(t *testing.T) {
+	tests := []struct {
+		status int
+		want   error
+	}{
+		{http.StatusNotFound, ErrNotFound},
+		{http.StatusUnauthorized, ErrUnauthorized},
+		{http.StatusForbidden, ErrUnauthorized},
+		{http.StatusBadGateway, ErrServer},
+	}
+
+	for _, test := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "nope", test.status)
+		}))
+
+		i := testInvoker(server, time.Second)
+		i.AccessKey = "secret"
+		_, err := i.get(context.Background(), i.url("api/get_set", true))
+		if !errors.Is(err, test.want) {
+			t.Errorf("status %d gave %v want %v", test.status, err, test.want)
+		}
+		if err != nil && strings.Contains(err.Error(), "secret") {
+			t.Errorf("error leaks the access key: %v", err)
+		}
+		server.Close()
+	}
+}
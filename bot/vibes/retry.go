@@ -0,0 +1,101 @@
+package vibes
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+//RetryPolicy controls how failed calls are retried, only transient failures
+//are retried and every call the Invoker makes is an idempotent GET
+type RetryPolicy struct {
+	//MaxAttempts including the first one, less than one means one
+	MaxAttempts int
+	//BaseDelay is the wait before the second attempt, doubling after that
+	BaseDelay time.Duration
+	//MaxDelay caps the wait between attempts
+	MaxDelay time.Duration
+	//Jitter is the fraction of each wait which is randomised from 0 to 1
+	Jitter float64
+}
+
+//DefaultRetryPolicy is used when Invoker.Retry is nil
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    10 * time.Second,
+	Jitter:      0.5,
+}
+
+func (p RetryPolicy) attempts() int {
+	if p.MaxAttempts < 1 {
+		return 1
+	}
+
+	return p.MaxAttempts
+}
+
+//delay returns how long to wait after the given failed attempt starting at 0
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	result := p.BaseDelay
+	for i := 0; i < attempt && (p.MaxDelay <= 0 || result < p.MaxDelay); i++ {
+		result *= 2
+	}
+	if p.MaxDelay > 0 && result > p.MaxDelay {
+		result = p.MaxDelay
+	}
+
+	jitter := p.Jitter
+	if jitter > 1 {
+		jitter = 1
+	}
+	if jitter > 0 {
+		result -= time.Duration(rand.Float64() * jitter * float64(result))
+	}
+
+	return result
+}
+
+//retryable reports if the call failed in a way that might work next time
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var e *Error
+	if !errors.As(err, &e) {
+		return false
+	}
+
+	switch {
+	case e.Kind == ErrTimeout, e.Kind == ErrServer, e.Kind == ErrStream:
+		return true
+	case e.StatusCode == http.StatusTooManyRequests:
+		return true
+	case e.Kind == nil && e.StatusCode == 0:
+		//Connection refused, reset and friends
+		return true
+	}
+
+	return false
+}
+
+//Temporary reports if err is a failure which should clear up by itself,
+//either a transient backend failure or an open circuit
+func Temporary(err error) bool {
+	return retryable(err) || errors.Is(err, ErrCircuitOpen)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,104 @@
+package vibes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryDelay(t *testing.T) {
+	capped := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	uncapped := RetryPolicy{BaseDelay: 100 * time.Millisecond}
+
+	tests := []struct {
+		policy  RetryPolicy
+		attempt int
+		want    time.Duration
+	}{
+		{capped, 0, 100 * time.Millisecond},
+		{capped, 1, 200 * time.Millisecond},
+		{capped, 2, 400 * time.Millisecond},
+		{capped, 3, 800 * time.Millisecond},
+		{capped, 4, time.Second},
+		{capped, 50, time.Second},
+		{uncapped, 0, 100 * time.Millisecond},
+		{uncapped, 5, 3200 * time.Millisecond},
+		{RetryPolicy{BaseDelay: 2 * time.Second, MaxDelay: time.Second}, 0, time.Second},
+	}
+
+	for _, test := range tests {
+		if got := test.policy.delay(test.attempt); got != test.want {
+			t.Errorf("%+v delay(%d) = %s want %s", test.policy, test.attempt, got, test.want)
+		}
+	}
+}
+
+func TestRetryDelayJitter(t *testing.T) {
+	tests := []struct {
+		jitter float64
+		min    time.Duration
+	}{
+		{0.5, 400 * time.Millisecond},
+		{1, 0},
+		//More than all of it is capped at all of it
+		{3, 0},
+	}
+
+	for _, test := range tests {
+		policy := RetryPolicy{
+			BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second, Jitter: test.jitter,
+		}
+		for i := 0; i < 100; i++ {
+			if got := policy.delay(3); got < test.min || got > 800*time.Millisecond {
+				t.Fatalf("jitter %v gave %s want %s to 800ms", test.jitter, got, test.min)
+			}
+		}
+	}
+}
+
+func TestRetryAttempts(t *testing.T) {
+	for max, want := range map[int]int{-1: 1, 0: 1, 1: 1, 4: 4} {
+		if got := (RetryPolicy{MaxAttempts: max}).attempts(); got != want {
+			t.Errorf("MaxAttempts %d gave %d attempts want %d", max, got, want)
+		}
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		want      bool
+		temporary bool
+	}{
+		{"timeout", &Error{Kind: ErrTimeout}, true, true},
+		{"server", &Error{Kind: ErrServer, StatusCode: 503}, true, true},
+		{"stream", &Error{Kind: ErrStream}, true, true},
+		{"rate limited", &Error{StatusCode: http.StatusTooManyRequests}, true, true},
+		{"connection refused", &Error{Err: errors.New("connection refused")}, true, true},
+		{"wrapped", fmt.Errorf("getting sample: %w", &Error{Kind: ErrTimeout}), true, true},
+		{"not found", &Error{Kind: ErrNotFound, StatusCode: 404}, false, false},
+		{"unauthorized", &Error{Kind: ErrUnauthorized, StatusCode: 401}, false, false},
+		{"decode", &Error{Kind: ErrDecode}, false, false},
+		{"bad request", &Error{StatusCode: 400}, false, false},
+		{"circuit open", &Error{Kind: ErrCircuitOpen}, false, true},
+		{"cancelled", &Error{Err: context.Canceled}, false, false},
+		{"plain", io.ErrUnexpectedEOF, false, false},
+		{"nil", nil, false, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := retryable(test.err); got != test.want {
+				t.Errorf("retryable(%v) = %v want %v", test.err, got, test.want)
+			}
+			if got := Temporary(test.err); got != test.temporary {
+				t.Errorf("Temporary(%v) = %v want %v", test.err, got, test.temporary)
+			}
+		})
+	}
+}
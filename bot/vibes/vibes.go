@@ -1,181 +1,372 @@
-package vibes
-
-import (
-	"encoding/json"
-	"fmt"
-	"io"
-	"io/ioutil"
-	"net/http"
-	"net/url"
-	"time"
-
-	"github.com/pkg/errors"
-)
-
-//Invoker used to invoke the api endpoints
-type Invoker struct {
-	Endpoint  string
-	AccessKey string
-	Scheme    string
-	Username  string
-	Password  string
-}
-
-//GetSets returns sets from server
-func (i *Invoker) GetSets() ([]string, error) {
-	url := url.URL{
-		Scheme: i.Scheme,
-		Host:   i.Endpoint,
-		Path:   "api/get_set",
-	}
-	q := url.Query()
-	q.Set("access_key", i.AccessKey)
-	url.RawQuery = q.Encode()
-
-	req, err := http.NewRequest("GET", url.String(), nil)
-	if err != nil {
-		return nil, err
-	}
-	req.SetBasicAuth(i.Username, i.Password)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, errors.Wrap(
-			err,
-			fmt.Sprintf("unable to fetch %s", url.String()),
-		)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return nil, err
-		}
-		return nil, fmt.Errorf("Unable to fetch %s body %s", url.String(), string(bodyBytes))
-	}
-
-	var data []string
-	err = json.NewDecoder(resp.Body).Decode(&data)
-
-	return data, err
-
-}
-
-type sampleLengthResult struct {
-	LengthMS float64 `json:"length_ms"`
-}
-
-//GetSampleLength returns sample length
-func (i *Invoker) GetSampleLength() (time.Duration, error) {
-	url := url.URL{
-		Scheme: i.Scheme,
-		Host:   i.Endpoint,
-		Path:   "api/get_sample_length",
-	}
-	q := url.Query()
-	q.Set("access_key", i.AccessKey)
-	url.RawQuery = q.Encode()
-
-	req, err := http.NewRequest("GET", url.String(), nil)
-	if err != nil {
-		return 0, err
-	}
-	req.SetBasicAuth(i.Username, i.Password)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return 0, errors.Wrap(
-			err,
-			fmt.Sprintf("unable to fetch %s", url.String()),
-		)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return 0, err
-		}
-		return 0, fmt.Errorf("Unable to fetch %s body %s", url.String(), string(bodyBytes))
-	}
-
-	var data sampleLengthResult
-	err = json.NewDecoder(resp.Body).Decode(&data)
-
-	return time.Duration(data.LengthMS) * time.Millisecond, err
-
-}
-
-//GetBellStream returns bell sound stream from server
-func (i *Invoker) GetBellStream() (io.ReadCloser, error) {
-	url := url.URL{
-		Scheme: i.Scheme, Host: i.Endpoint, Path: "api/get_bell",
-	}
-
-	req, err := http.NewRequest("GET", url.String(), nil)
-	if err != nil {
-		return nil, err
-	}
-	req.SetBasicAuth(i.Username, i.Password)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, errors.Wrap(
-			err,
-			fmt.Sprintf("unable to fetch %s", url.String()),
-		)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		defer resp.Body.Close()
-		bodyBytes, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return nil, err
-		}
-		return nil, fmt.Errorf("Unable to fetch %s body %s", url.String(), string(bodyBytes))
-	}
-
-	return resp.Body, err
-}
-
-//GetSampleStream returns sample stream from server
-func (i *Invoker) GetSampleStream(hour int, set, city, country string) (io.ReadCloser, error) {
-	fmt.Printf("Getting Set:%s Hour:%d\n", set, hour)
-	path := fmt.Sprintf("api/get_sample/%s/%s/%s/%d", country, city, set, hour)
-	url := url.URL{
-		Scheme: i.Scheme, Host: i.Endpoint, Path: path,
-	}
-	q := url.Query()
-	q.Set("access_key", i.AccessKey)
-	url.RawQuery = q.Encode()
-
-	req, err := http.NewRequest("GET", url.String(), nil)
-	if err != nil {
-		return nil, err
-	}
-	req.SetBasicAuth(i.Username, i.Password)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, errors.Wrap(
-			err,
-			fmt.Sprintf("unable to fetch %s", url.String()),
-		)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		defer resp.Body.Close()
-		bodyBytes, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return nil, err
-		}
-		return nil, fmt.Errorf("Unable to fetch %s body %s", url.String(), string(bodyBytes))
-	}
-
-	return resp.Body, err
-}
+package vibes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+)
+
+//DefaultClient is the http client shared by every Invoker without a Client
+var DefaultClient = &http.Client{}
+
+//DefaultTimeout is how long a call can go without progress when
+//Invoker.Timeout is zero
+const DefaultTimeout = 30 * time.Second
+
+//Invoker used to invoke the api endpoints
+type Invoker struct {
+	Endpoint  string
+	AccessKey string
+	Scheme    string
+	Username  string
+	Password  string
+	//Client used for requests, DefaultClient when nil
+	Client *http.Client
+	//Timeout is how long a call can go without progress, first waiting for
+	//the response then between reads of the body, so long streams aren't
+	//cut off part way through
+	Timeout time.Duration
+	//Retry policy for transient failures, DefaultRetryPolicy when nil
+	Retry *RetryPolicy
+	//Breaker guarding the endpoint, the one shared through BreakerFor when
+	//nil
+	Breaker *Breaker
+	//Cache for samples, samples are always downloaded when nil
+	Cache *Cache
+}
+
+func (i *Invoker) client() *http.Client {
+	if i.Client != nil {
+		return i.Client
+	}
+
+	return DefaultClient
+}
+
+func (i *Invoker) timeout() time.Duration {
+	if i.Timeout > 0 {
+		return i.Timeout
+	}
+
+	return DefaultTimeout
+}
+
+func (i *Invoker) retryPolicy() RetryPolicy {
+	if i.Retry != nil {
+		return *i.Retry
+	}
+
+	return DefaultRetryPolicy
+}
+
+func (i *Invoker) breaker() *Breaker {
+	if i.Breaker != nil {
+		return i.Breaker
+	}
+
+	return BreakerFor(i.Endpoint)
+}
+
+//WaitAvailable blocks until the endpoint's circuit breaker would allow a
+//call or ctx is done
+func (i *Invoker) WaitAvailable(ctx context.Context) error {
+	return i.breaker().Wait(ctx)
+}
+
+func (i *Invoker) url(path string, withKey bool) url.URL {
+	result := url.URL{
+		Scheme: i.Scheme, Host: i.Endpoint, Path: path,
+	}
+	if withKey {
+		q := result.Query()
+		q.Set("access_key", i.AccessKey)
+		result.RawQuery = q.Encode()
+	}
+
+	return result
+}
+
+//idleDeadline cancels a call once it has gone timeout without progress
+type idleDeadline struct {
+	timeout time.Duration
+	timer   *time.Timer
+	cancel  context.CancelFunc
+	expired atomic.Bool
+}
+
+func newIdleDeadline(ctx context.Context, timeout time.Duration) (context.Context, *idleDeadline) {
+	ctx, cancel := context.WithCancel(ctx)
+	d := &idleDeadline{timeout: timeout, cancel: cancel}
+	d.timer = time.AfterFunc(timeout, func() {
+		d.expired.Store(true)
+		cancel()
+	})
+
+	return ctx, d
+}
+
+//progress pushes the deadline back
+func (d *idleDeadline) progress() {
+	if !d.expired.Load() {
+		d.timer.Reset(d.timeout)
+	}
+}
+
+//stop releases the call context
+func (d *idleDeadline) stop() {
+	d.timer.Stop()
+	d.cancel()
+}
+
+//wrap converts err from the call to an *Error, failures caused by the
+//deadline are timeouts rather than cancellations
+func (d *idleDeadline) wrap(u url.URL, err error) *Error {
+	if d.expired.Load() {
+		err = context.DeadlineExceeded
+	}
+
+	return transportError(u, err)
+}
+
+//idleBody is a response body which keeps its call's deadline moving while
+//data arrives, read failures are returned as *Error
+type idleBody struct {
+	io.ReadCloser
+	url      url.URL
+	deadline *idleDeadline
+}
+
+func (b *idleBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.deadline.progress()
+	}
+	if err != nil && err != io.EOF {
+		return n, b.deadline.wrap(b.url, err)
+	}
+
+	return n, err
+}
+
+func (b *idleBody) Close() error {
+	defer b.deadline.stop()
+	return b.ReadCloser.Close()
+}
+
+//get performs the request retrying transient failures, the caller must
+//close the body which also releases the deadline, failures including ones
+//reading the body are returned as *Error
+func (i *Invoker) get(ctx context.Context, url url.URL) (io.ReadCloser, error) {
+	resp, err := i.getResponse(ctx, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+//getResponse is get with extra request headers returning the whole
+//response, not modified is accepted for conditional requests
+func (i *Invoker) getResponse(
+	ctx context.Context, url url.URL, header http.Header,
+) (*http.Response, error) {
+	policy := i.retryPolicy()
+	breaker := i.breaker()
+
+	for attempt := 0; ; attempt++ {
+		if !breaker.allow() {
+			return nil, &Error{Kind: ErrCircuitOpen, URL: redactURL(url)}
+		}
+
+		resp, err := i.do(ctx, url, header)
+		breaker.record(err)
+		if err == nil {
+			return resp, nil
+		}
+
+		if attempt+1 >= policy.attempts() || !retryable(err) || ctx.Err() != nil {
+			return nil, err
+		}
+		if err := sleep(ctx, policy.delay(attempt)); err != nil {
+			return nil, transportError(url, err)
+		}
+	}
+}
+
+//do performs a single attempt at the request
+func (i *Invoker) do(
+	ctx context.Context, url url.URL, header http.Header,
+) (*http.Response, error) {
+	ctx, deadline := newIdleDeadline(ctx, i.timeout())
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url.String(), nil)
+	if err != nil {
+		deadline.stop()
+		return nil, transportError(url, err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.SetBasicAuth(i.Username, i.Password)
+
+	resp, err := i.client().Do(req)
+	if err != nil {
+		defer deadline.stop()
+		return nil, deadline.wrap(url, err)
+	}
+
+	conditional := header.Get("If-None-Match") != "" || header.Get("If-Modified-Since") != ""
+	if resp.StatusCode != http.StatusOK &&
+		!(conditional && resp.StatusCode == http.StatusNotModified) {
+		defer deadline.stop()
+		defer resp.Body.Close()
+		bodyBytes, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, deadline.wrap(url, err)
+		}
+		return nil, statusError(url, resp.StatusCode, bodyBytes)
+	}
+
+	deadline.progress()
+	resp.Body = &idleBody{ReadCloser: resp.Body, url: url, deadline: deadline}
+	return resp, nil
+}
+
+//GetSets returns sets from server
+func (i *Invoker) GetSets() ([]string, error) {
+	return i.GetSetsContext(context.Background())
+}
+
+//GetSetsContext returns sets from server
+func (i *Invoker) GetSetsContext(ctx context.Context) ([]string, error) {
+	url := i.url("api/get_set", true)
+	body, err := i.get(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var data []string
+	err = json.NewDecoder(body).Decode(&data)
+
+	return data, decodeError(url, err)
+}
+
+type sampleLengthResult struct {
+	LengthMS float64 `json:"length_ms"`
+}
+
+//GetSampleLength returns sample length
+func (i *Invoker) GetSampleLength() (time.Duration, error) {
+	return i.GetSampleLengthContext(context.Background())
+}
+
+//GetSampleLengthContext returns sample length
+func (i *Invoker) GetSampleLengthContext(ctx context.Context) (time.Duration, error) {
+	url := i.url("api/get_sample_length", true)
+	body, err := i.get(ctx, url)
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+
+	var data sampleLengthResult
+	err = json.NewDecoder(body).Decode(&data)
+
+	return time.Duration(data.LengthMS) * time.Millisecond, decodeError(url, err)
+}
+
+//GetBellStream returns bell sound stream from server
+func (i *Invoker) GetBellStream() (io.ReadCloser, error) {
+	return i.GetBellStreamContext(context.Background())
+}
+
+//GetBellStreamContext returns bell sound stream from server the stream is
+//aborted when ctx is done
+func (i *Invoker) GetBellStreamContext(ctx context.Context) (io.ReadCloser, error) {
+	return i.get(ctx, i.url("api/get_bell", false))
+}
+
+//GetSampleStream returns sample stream from server
+func (i *Invoker) GetSampleStream(hour int, set, city, country string) (io.ReadCloser, error) {
+	return i.GetSampleStreamContext(context.Background(), hour, set, city, country)
+}
+
+//GetSampleStreamContext returns sample stream from server the stream is
+//aborted when ctx is done
+func (i *Invoker) GetSampleStreamContext(
+	ctx context.Context, hour int, set, city, country string,
+) (io.ReadCloser, error) {
+	return i.GetSampleVariantStreamContext(ctx, hour, set, city, country, "")
+}
+
+//GetSampleVariantStreamContext is GetSampleStreamContext for a caller that
+//expects the sample for the weather variant, a cached sample is only
+//returned if it was fetched expecting the same variant
+func (i *Invoker) GetSampleVariantStreamContext(
+	ctx context.Context, hour int, set, city, country, variant string,
+) (io.ReadCloser, error) {
+	path := fmt.Sprintf("api/get_sample/%s/%s/%s/%d", country, city, set, hour)
+	url := i.url(path, true)
+	if i.Cache == nil {
+		return i.get(ctx, url)
+	}
+
+	key := fmt.Sprintf("%s/%s", i.Endpoint, path)
+	if variant != "" {
+		key += "#" + variant
+	}
+	return i.Cache.get(ctx, key, func(ctx context.Context, header http.Header) (*http.Response, error) {
+		return i.getResponse(ctx, url, header)
+	})
+}
+
+//Weather is the backend's view of the weather in a city
+type Weather struct {
+	Cloud   int `json:"cloud"`
+	Raining int `json:"raining"`
+	Snowing int `json:"snowing"`
+}
+
+type weatherResult struct {
+	Weather Weather `json:"weather"`
+}
+
+//Variant returns which version of a sample the backend picks for this
+//weather
+func (w Weather) Variant() string {
+	switch {
+	case w.Raining > 0:
+		return "rain"
+	case w.Snowing > 0:
+		return "snow"
+	}
+
+	return "none"
+}
+
+//GetWeather returns the weather for the city
+func (i *Invoker) GetWeather(city, country string) (Weather, error) {
+	return i.GetWeatherContext(context.Background(), city, country)
+}
+
+//GetWeatherContext returns the weather for the city
+func (i *Invoker) GetWeatherContext(ctx context.Context, city, country string) (Weather, error) {
+	url := i.url(fmt.Sprintf("api/get_weather/%s/%s", country, city), true)
+	body, err := i.get(ctx, url)
+	if err != nil {
+		return Weather{}, err
+	}
+	defer body.Close()
+
+	var data weatherResult
+	err = json.NewDecoder(body).Decode(&data)
+
+	return data.Weather, decodeError(url, err)
+}
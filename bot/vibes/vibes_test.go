@@ -0,0 +1,143 @@
+package vibes
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+//testInvoker returns an invoker for the server which doesn't retry
+func testInvoker(server *httptest.Server, timeout time.Duration) *Invoker {
+	return &Invoker{
+		Endpoint: strings.TrimPrefix(server.URL, "http://"),
+		Scheme:   "http",
+		Client:   server.Client(),
+		Timeout:  timeout,
+		Retry:    &RetryPolicy{MaxAttempts: 1},
+		Breaker:  &Breaker{Threshold: 100},
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	const timeout = 100 * time.Millisecond
+	tests := []struct {
+		name string
+		//chunks are written with gap between them
+		chunks  int
+		gap     time.Duration
+		wantErr error
+	}{
+		{"fast", 3, 0, nil},
+		{"slow but steady", 6, timeout / 3, nil},
+		{"stalls", 2, 3 * timeout, ErrTimeout},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for i := 0; i < test.chunks; i++ {
+					if i > 0 {
+						select {
+						case <-time.After(test.gap):
+						case <-r.Context().Done():
+							return
+						}
+					}
+					w.Write([]byte("chunk"))
+					w.(http.Flusher).Flush()
+				}
+			}))
+			defer server.Close()
+
+			i := testInvoker(server, timeout)
+			body, err := i.get(context.Background(), i.url("stream", false))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer body.Close()
+
+			b, err := io.ReadAll(body)
+			if test.wantErr == nil {
+				if err != nil || len(b) != test.chunks*len("chunk") {
+					t.Errorf("read %d bytes %v", len(b), err)
+				}
+				return
+			}
+			var backendErr *Error
+			if !errors.Is(err, test.wantErr) || !errors.As(err, &backendErr) || !Temporary(err) {
+				t.Errorf("got %v want a temporary %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestNoResponseTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	i := testInvoker(server, 50*time.Millisecond)
+	if _, err := i.get(context.Background(), i.url("stream", false)); !errors.Is(err, ErrTimeout) {
+		t.Errorf("got %v want a timeout", err)
+	}
+}
+
+func TestSampleVariantCache(t *testing.T) {
+	weather := "none"
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		io.WriteString(w, weather)
+	}))
+	defer server.Close()
+
+	cache, err := NewCache(t.TempDir(), 1024*1024, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := testInvoker(server, time.Second)
+	i.Cache = cache
+
+	steps := []struct {
+		name string
+		//weather is what the backend sends for this step
+		weather      string
+		variant      string
+		want         string
+		wantRequests int
+	}{
+		{"no variant", "none", "", "none", 1},
+		{"no variant cached", "rain", "", "none", 1},
+		//The sample cached without a variant could be any weather
+		{"rain isn't the unknown sample", "rain", "rain", "rain", 2},
+		{"rain cached", "none", "rain", "rain", 2},
+		{"none isn't the rain sample", "none", "none", "none", 3},
+	}
+
+	for _, step := range steps {
+		weather = step.weather
+		stream, err := i.GetSampleVariantStreamContext(
+			context.Background(), 1, "cafe", "melbourne", "au", step.variant,
+		)
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		body, err := io.ReadAll(stream)
+		stream.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if string(body) != step.want || requests != step.wantRequests {
+			t.Errorf(
+				"%s: got %q after %d requests want %q after %d",
+				step.name, body, requests, step.want, step.wantRequests,
+			)
+		}
+	}
+}